@@ -0,0 +1,62 @@
+package flake
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrCheckChar is returned when the check character of a string ID does not
+// match the rest of the string.
+var ErrCheckChar = errors.New("check character mismatch")
+
+// checkChar returns the Luhn mod 62 check character of s, whose characters
+// must all be base62 digits. It detects every single mistyped character and
+// most swaps of adjacent characters.
+func checkChar(s string) (byte, bool) {
+	sum, factor := 0, 2
+	for i := len(s) - 1; i >= 0; i-- {
+		d := strings.IndexByte(base62Alphabet, s[i])
+		if d < 0 {
+			return 0, false
+		}
+		d *= factor
+		sum += d/62 + d%62
+		factor = 3 - factor
+	}
+	return base62Alphabet[(62-sum%62)%62], true
+}
+
+// appendCheckChar appends the check character of s to s.
+func appendCheckChar(s string) string {
+	c, _ := checkChar(s)
+	return s + string(c)
+}
+
+// stripCheckChar validates the check character at the end of s and returns s
+// without it.
+func stripCheckChar(s string) (string, error) {
+	if s == "" {
+		return "", ErrCheckChar
+	}
+	body := s[:len(s)-1]
+	if c, ok := checkChar(body); !ok || c != s[len(s)-1] {
+		return "", ErrCheckChar
+	}
+	return body, nil
+}
+
+// CheckedBase62 formats the ID in base62 followed by a check character, for
+// codes typed in by people
+func (id ID) CheckedBase62() string {
+	return appendCheckChar(id.Base62())
+}
+
+// ParseChecked parses an ID formatted by CheckedBase62. It returns
+// ErrCheckChar if the check character does not match.
+func ParseChecked(s string) (ID, error) {
+	body, err := stripCheckChar(s)
+	if err != nil {
+		return 0, err
+	}
+	return ParseBase62(body)
+}
@@ -0,0 +1,59 @@
+package flake
+
+import "testing"
+
+func TestParseChecked(t *testing.T) {
+	f, err := NewWithOptions(1, WithDefaultFormat(Base62), WithCheckChar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := f.NextID()
+	s := f.Format(id)
+	if s != id.CheckedBase62() {
+		t.Fatalf("Format() = %q, want %q", s, id.CheckedBase62())
+	}
+
+	for _, parse := range []func(string) (ID, error){ParseChecked, f.Parse} {
+		got, err := parse(s)
+		if err != nil || got != id {
+			t.Errorf("parse(%q) = %d, %v, want %d", s, got, err, id)
+		}
+	}
+
+	// Every single mistyped character is detected.
+	for i := 0; i < len(s); i++ {
+		for j := 0; j < len(base62Alphabet); j++ {
+			if base62Alphabet[j] == s[i] {
+				continue
+			}
+			typo := s[:i] + string(base62Alphabet[j]) + s[i+1:]
+			if _, err := ParseChecked(typo); err != ErrCheckChar {
+				t.Fatalf("ParseChecked(%q) error = %v, want ErrCheckChar", typo, err)
+			}
+		}
+	}
+
+	// Luhn mod N misses some swaps of adjacent characters, but not many.
+	missed := 0
+	for i := 0; i+1 < len(s); i++ {
+		if s[i] == s[i+1] {
+			continue
+		}
+		swapped := s[:i] + string(s[i+1]) + string(s[i]) + s[i+2:]
+		if _, err := ParseChecked(swapped); err == nil {
+			missed++
+		}
+	}
+	if missed > 1 {
+		t.Errorf("%d of %d swaps went undetected in %q", missed, len(s)-1, s)
+	}
+	if got, want := appendCheckChar("12"), "12v"; got != want {
+		t.Errorf("appendCheckChar(%q) = %q, want %q", "12", got, want)
+	}
+
+	for _, s := range []string{"", "A", "ab-c"} {
+		if _, err := ParseChecked(s); err == nil {
+			t.Errorf("ParseChecked(%q) did not fail", s)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package flake
+
+import "context"
+
+// contextKey is the key under which NewContext stores a generator.
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the generator f
+func NewContext(ctx context.Context, f *Flake) context.Context {
+	return context.WithValue(ctx, contextKey{}, f)
+}
+
+// FromContext returns the generator stored in ctx by NewContext, if any
+func FromContext(ctx context.Context) (*Flake, bool) {
+	f, ok := ctx.Value(contextKey{}).(*Flake)
+	return f, ok
+}
@@ -0,0 +1,18 @@
+package flake
+
+import (
+	"context"
+	"testing"
+)
+
+func TestContext(t *testing.T) {
+	f := New(1)
+	ctx := NewContext(context.Background(), f)
+	if got, ok := FromContext(ctx); !ok || got != f {
+		t.Errorf("FromContext() = %p, %v, want %p, true", got, ok, f)
+	}
+
+	if got, ok := FromContext(context.Background()); ok || got != nil {
+		t.Errorf("FromContext(empty) = %p, %v, want nil, false", got, ok)
+	}
+}
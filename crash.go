@@ -0,0 +1,72 @@
+package flake
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// crashMarker periodically records a timestamp the generator will not reach
+// before the next record, so that a restarted generator can skip past every
+// timestamp used before a crash.
+type crashMarker struct {
+	path     string
+	interval uint64 // in time units
+	due      atomic.Uint64
+	writing  atomic.Bool
+}
+
+// recoverCrash syncs the generator from the marker at the configured path and
+// starts recording markers.
+func (f *Flake) recoverCrash() error {
+	f.crash = &crashMarker{path: f.crashPath, interval: uint64(f.crashEvery / f.unit)}
+
+	b, err := os.ReadFile(f.crashPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	n, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid crash marker in %s: %v", f.crashPath, err)
+	}
+	f.SyncFrom(ID(n))
+	return nil
+}
+
+// touch writes a new marker if one is due at the given timestamp, in the
+// background unless wait is set. The next marker is due an interval later
+// once the write succeeded, and right away after a failed one.
+func (f *Flake) touch(timestamp uint64, wait bool) {
+	m := f.crash
+	if timestamp < m.due.Load() || !m.writing.CompareAndSwap(false, true) {
+		return
+	}
+
+	ahead := min(timestamp+2*m.interval, f.layout.maxTimestamp())
+	if f.descending {
+		ahead = f.layout.maxTimestamp() - ahead
+	}
+	marker := f.layout.pack(ahead, 0, 0, 0)
+	write := func() {
+		defer m.writing.Store(false)
+		tmp := m.path + ".tmp"
+		if os.WriteFile(tmp, []byte(strconv.FormatUint(uint64(marker), 10)+"\n"), 0o644) != nil {
+			return
+		}
+		if os.Rename(tmp, m.path) == nil {
+			m.due.Store(timestamp + m.interval)
+		}
+	}
+	if wait {
+		write()
+	} else {
+		go write()
+	}
+}
@@ -0,0 +1,106 @@
+package flake
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCrashSafety(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "marker")
+	f, err := NewWithOptions(1, WithCrashSafety(path, time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := f.NextID()
+
+	// The marker is written in the background.
+	waitWritten(f)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if marker := ID(n); marker.Time().Before(id.Time().Add(2 * time.Second)) {
+		t.Errorf("marker at %v is not two intervals after the ID at %v", marker.Time(), id.Time())
+	}
+
+	restarted, err := NewWithOptions(1, WithCrashSafety(path, time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := restarted.NextID(); next <= ID(n) {
+		t.Errorf("first ID after restart %d does not exceed the marker %d", next, n)
+	}
+	waitWritten(restarted)
+}
+
+func TestCrashSafetyFutureMarker(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "marker")
+	marker := FirstIDAt(time.Now().Add(time.Hour))
+	if err := os.WriteFile(path, []byte(strconv.FormatUint(uint64(marker), 10)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := NewWithOptions(1, WithCrashSafety(path, time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := f.NextID(); id <= marker {
+		t.Errorf("first ID %d does not exceed the marker %d", id, marker)
+	}
+	waitWritten(f)
+}
+
+func TestCrashSafetyFailedWrite(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "state")
+	path := filepath.Join(dir, "marker")
+	f, err := NewWithOptions(1, WithCrashSafety(path, time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.NextID()
+	waitWritten(f)
+
+	// The directory is missing, so the write failed and the next ID tries
+	// again rather than waiting for the interval.
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	f.NextID()
+	waitWritten(f)
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("marker not written after a failed write: %v", err)
+	}
+}
+
+// waitWritten waits for the background write of a crash marker to finish.
+func waitWritten(f *Flake) {
+	for f.crash.writing.Load() {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCrashSafetyInvalidMarker(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := NewWithOptions(1, WithCrashSafety(filepath.Join(dir, "missing"), time.Second)); err != nil {
+		t.Errorf("missing marker: %v", err)
+	}
+
+	path := filepath.Join(dir, "marker")
+	if err := os.WriteFile(path, []byte("garbage"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewWithOptions(1, WithCrashSafety(path, time.Second)); err == nil {
+		t.Error("invalid marker accepted")
+	}
+	if _, err := NewWithOptions(1, WithCrashSafety(path, 0)); err == nil {
+		t.Error("zero interval accepted")
+	}
+}
@@ -0,0 +1,143 @@
+package flake
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Components holds the decoded fields of an ID
+type Components struct {
+	Time     time.Time
+	Tag      uint64
+	WorkerID uint64
+	Sequence uint64
+}
+
+var (
+	// SnowflakeEpoch is the custom epoch of Twitter Snowflake IDs,
+	// Nov 04 2010 01:42:54.657 UTC.
+	SnowflakeEpoch = time.UnixMilli(1288834974657).UTC()
+
+	// snowflakeLayout is the 41/10/12 layout of Twitter Snowflake IDs. The
+	// worker field holds the 5-bit datacenter id followed by the 5-bit
+	// worker id.
+	snowflakeLayout = Layout{TimestampBits: 41, WorkerBits: 10, SequenceBits: 12}
+)
+
+// DecodeSnowflake decodes a Twitter Snowflake ID. Snowflake IDs use their own
+// layout and epoch and are not compatible with the IDs of this package.
+func DecodeSnowflake(id uint64) Components {
+	l := snowflakeLayout
+	return Components{
+		Time:     SnowflakeEpoch.Add(time.Duration(l.timestamp(ID(id))) * time.Millisecond).UTC(),
+		WorkerID: l.worker(ID(id)),
+		Sequence: l.sequence(ID(id)),
+	}
+}
+
+// FirstIDAt returns the smallest ID with the default layout whose timestamp is
+// t, truncated to the millisecond. It is useful as the lower bound of a range
+// query. Times before the epoch return the zero ID.
+func FirstIDAt(t time.Time) ID {
+	if t.Before(Epoch) {
+		return 0
+	}
+	return DefaultLayout.pack(uint64(t.Sub(Epoch)/time.Millisecond), 0, 0, 0)
+}
+
+// FirstIDOnDate returns the first ID of the given calendar day in loc
+func FirstIDOnDate(year int, month time.Month, day int, loc *time.Location) ID {
+	return FirstIDAt(time.Date(year, month, day, 0, 0, 0, 0, loc))
+}
+
+// DecodeWith decodes an ID generated with the given layout, without tag
+// bits, and epoch, as used with WithLayout and WithEpoch. It allows decoding
+// IDs minted under a layout that is no longer in use.
+func DecodeWith(id ID, timestampBits, workerBits, sequenceBits uint, epoch time.Time) Components {
+	l := Layout{TimestampBits: timestampBits, WorkerBits: workerBits, SequenceBits: sequenceBits}
+	return Components{
+		Time:     epoch.Add(time.Duration(l.timestamp(id)) * time.Millisecond).UTC(),
+		WorkerID: l.worker(id),
+		Sequence: l.sequence(id),
+	}
+}
+
+// Dump returns a multi-line description of an ID generated with the default
+// layout, for debugging. The format is stable.
+func (id ID) Dump() string {
+	return fmt.Sprintf("id:       %d\nbase36:   %s\nhex:      %s\ntime:     %s\nworker:   %d\nsequence: %d\n",
+		uint64(id), id.String(), id.Hex(), id.Time().Format(time.RFC3339Nano),
+		id.WorkerID(), DefaultLayout.sequence(id))
+}
+
+// CompareAcrossEpochs orders two IDs with the default layout generated with
+// different epochs by their absolute creation time, then by worker id and
+// sequence. It returns -1 if a sorts before b, 1 if it sorts after b and 0 if
+// they are equal.
+func CompareAcrossEpochs(a ID, ae time.Time, b ID, be time.Time) int {
+	ca := DecodeWith(a, TimestampBits, HostBits, SequenceBits, ae)
+	cb := DecodeWith(b, TimestampBits, HostBits, SequenceBits, be)
+	switch {
+	case ca.Time.Before(cb.Time):
+		return -1
+	case ca.Time.After(cb.Time):
+		return 1
+	case ca.WorkerID != cb.WorkerID:
+		return cmp.Compare(ca.WorkerID, cb.WorkerID)
+	default:
+		return cmp.Compare(ca.Sequence, cb.Sequence)
+	}
+}
+
+// plausibleSince is the earliest creation time considered plausible for IDs of
+// unknown origin.
+var plausibleSince = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// GuessEpoch guesses the epoch of IDs generated with the given layout and a
+// millisecond timestamp, for IDs of unknown origin. It assumes the most recent
+// ID was generated just now and returns the epoch that places it at the
+// current time. It returns false if that would place the oldest ID before
+// 2000, which suggests a different layout or unit.
+func GuessEpoch(ids []ID, layout Layout) (time.Time, bool) {
+	if len(ids) == 0 {
+		return time.Time{}, false
+	}
+	minTS, maxTS := layout.timestamp(ids[0]), layout.timestamp(ids[0])
+	for _, id := range ids[1:] {
+		ts := layout.timestamp(id)
+		minTS = min(minTS, ts)
+		maxTS = max(maxTS, ts)
+	}
+	if maxTS > uint64(math.MaxInt64/time.Millisecond) {
+		return time.Time{}, false
+	}
+
+	epoch := time.Now().Add(-time.Duration(maxTS) * time.Millisecond).Truncate(time.Millisecond)
+	oldest := epoch.Add(time.Duration(minTS) * time.Millisecond)
+	if oldest.Before(plausibleSince) {
+		return time.Time{}, false
+	}
+	return epoch.UTC(), true
+}
+
+// SameEpochWindow checks that IDs generated with the given layout and a
+// millisecond timestamp plausibly use epoch, meaning that they decode to
+// creation times between 2000 and a minute from now. It returns an error
+// naming the first ID that does not. IDs of a foreign epoch can pass the check
+// if their creation times happen to be plausible under epoch as well.
+func SameEpochWindow(ids []ID, epoch time.Time, layout Layout) error {
+	latest := time.Now().Add(time.Minute)
+	for i, id := range ids {
+		ts := layout.timestamp(id)
+		if ts > uint64(math.MaxInt64/time.Millisecond) {
+			return fmt.Errorf("ID %d at index %d is outside the window of epoch %v", id, i, epoch)
+		}
+		if t := epoch.Add(time.Duration(ts) * time.Millisecond); t.Before(plausibleSince) || t.After(latest) {
+			return fmt.Errorf("ID %d at index %d dates from %v, outside the window of epoch %v",
+				id, i, t.UTC(), epoch)
+		}
+	}
+	return nil
+}
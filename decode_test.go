@@ -0,0 +1,203 @@
+package flake
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodeSnowflake(t *testing.T) {
+	// Tweet used as an example in the Twitter API documentation.
+	c := DecodeSnowflake(1050118621198921728)
+
+	want := time.Date(2018, 10, 10, 20, 19, 24, 211e6, time.UTC)
+	if !c.Time.Equal(want) {
+		t.Errorf("Time = %v, want %v", c.Time, want)
+	}
+	if datacenter, worker := c.WorkerID>>5, c.WorkerID&31; datacenter != 10 || worker != 27 {
+		t.Errorf("datacenter/worker = %d/%d, want 10/27", datacenter, worker)
+	}
+	if c.Sequence != 0 {
+		t.Errorf("Sequence = %d, want 0", c.Sequence)
+	}
+}
+
+func TestFirstIDAt(t *testing.T) {
+	at := time.Date(2024, 6, 1, 13, 4, 5, 123e6, time.UTC)
+	id := FirstIDAt(at)
+	if !id.Time().Equal(at) {
+		t.Errorf("Time() = %v, want %v", id.Time(), at)
+	}
+	if id.WorkerID() != 0 || DefaultLayout.sequence(id) != 0 {
+		t.Errorf("FirstIDAt(%v) has worker or sequence bits set", at)
+	}
+	if got := FirstIDAt(Epoch.Add(-time.Hour)); got != 0 {
+		t.Errorf("FirstIDAt(before epoch) = %d, want 0", got)
+	}
+}
+
+func TestFirstIDOnDate(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	utc := FirstIDOnDate(2024, time.June, 1, time.UTC)
+	local := FirstIDOnDate(2024, time.June, 1, ny)
+	if utc == local {
+		t.Fatal("boundaries in UTC and New York are equal")
+	}
+
+	// Midnight in New York is 04:00 UTC during daylight saving time.
+	if got, want := local.Time().Sub(utc.Time()), 4*time.Hour; got != want {
+		t.Errorf("New York boundary is %v after UTC, want %v", got, want)
+	}
+}
+
+func TestTimeIsUTC(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	local := time.Local
+	time.Local = berlin
+	defer func() { time.Local = local }()
+
+	// Berlin springs forward from 02:00 to 03:00 local time half an hour
+	// before this instant.
+	at := time.Date(2024, 3, 31, 1, 30, 0, 0, time.UTC)
+	id := FirstIDAt(at)
+	if got := id.Time(); got.Location() != time.UTC || !got.Equal(at) {
+		t.Errorf("Time() = %v, want %v", got, at)
+	}
+
+	f, err := NewWithOptions(1, WithEpoch(Epoch.In(berlin)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.Time(id); got.Location() != time.UTC || !got.Equal(at) {
+		t.Errorf("Flake.Time() = %v, want %v", got, at)
+	}
+	if got := DecodeSnowflake(1050118621198921728).Time; got.Location() != time.UTC {
+		t.Errorf("DecodeSnowflake time location = %v, want UTC", got.Location())
+	}
+}
+
+func TestDecodeWith(t *testing.T) {
+	at := time.Date(2024, 6, 1, 13, 4, 5, 0, time.UTC)
+	id := DefaultLayout.pack(uint64(at.Sub(Epoch)/time.Millisecond), 0, 700, 42)
+
+	old := DecodeWith(id, 41, 10, 13, Epoch)
+	if !old.Time.Equal(at) || old.WorkerID != 700 || old.Sequence != 42 {
+		t.Errorf("DecodeWith(41/10/13) = %+v, want %v, worker 700, sequence 42", old, at)
+	}
+
+	// Under a 43/8/13 layout the top two worker bits belong to the
+	// timestamp, which is then counted from a different epoch.
+	epoch := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := DecodeWith(id, 43, 8, 13, epoch)
+	if c.WorkerID != 700&255 || c.Sequence != 42 {
+		t.Errorf("DecodeWith(43/8/13) = %+v, want worker %d, sequence 42", c, 700&255)
+	}
+	wantTime := epoch.Add(time.Duration(uint64(id)>>21) * time.Millisecond)
+	if !c.Time.Equal(wantTime) {
+		t.Errorf("DecodeWith(43/8/13) time = %v, want %v", c.Time, wantTime)
+	}
+}
+
+func TestDump(t *testing.T) {
+	at := time.Date(2024, 6, 1, 13, 4, 5, 123e6, time.UTC)
+	id := DefaultLayout.pack(uint64(at.Sub(Epoch)/time.Millisecond), 0, 7, 163)
+
+	want := "id:       2492898382692016291\n" +
+		"base36:   ixu2q31hyx0j\n" +
+		"hex:      22988ddf0180e0a3\n" +
+		"time:     2024-06-01T13:04:05.123Z\n" +
+		"worker:   7\n" +
+		"sequence: 163\n"
+	if got := id.Dump(); got != want {
+		t.Errorf("Dump() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCompareAcrossEpochs(t *testing.T) {
+	oldEpoch := Epoch
+	newEpoch := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	idAt := func(epoch, t time.Time, worker uint64) ID {
+		return DefaultLayout.pack(uint64(t.Sub(epoch)/time.Millisecond), 0, worker, 0)
+	}
+
+	// The later ID is numerically smaller because its epoch is more recent.
+	early := idAt(oldEpoch, at, 1)
+	late := idAt(newEpoch, at.Add(time.Second), 1)
+	if late >= early {
+		t.Fatalf("test IDs are not inverted: %d, %d", early, late)
+	}
+	if got := CompareAcrossEpochs(early, oldEpoch, late, newEpoch); got != -1 {
+		t.Errorf("CompareAcrossEpochs(early, late) = %d, want -1", got)
+	}
+	if got := CompareAcrossEpochs(late, newEpoch, early, oldEpoch); got != 1 {
+		t.Errorf("CompareAcrossEpochs(late, early) = %d, want 1", got)
+	}
+
+	// Ties are broken by worker id.
+	a, b := idAt(oldEpoch, at, 1), idAt(newEpoch, at, 2)
+	if got := CompareAcrossEpochs(a, oldEpoch, b, newEpoch); got != -1 {
+		t.Errorf("CompareAcrossEpochs(worker 1, worker 2) = %d, want -1", got)
+	}
+	if got := CompareAcrossEpochs(a, oldEpoch, a, oldEpoch); got != 0 {
+		t.Errorf("CompareAcrossEpochs(a, a) = %d, want 0", got)
+	}
+}
+
+func TestGuessEpoch(t *testing.T) {
+	epoch := time.Date(2015, 3, 1, 0, 0, 0, 0, time.UTC)
+	f, err := NewWithOptions(1, WithEpoch(epoch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]ID, 100)
+	for i := range ids {
+		ids[i] = f.NextID()
+	}
+
+	got, ok := GuessEpoch(ids, DefaultLayout)
+	if !ok {
+		t.Fatal("GuessEpoch() found no plausible epoch")
+	}
+	if d := got.Sub(epoch); d < -time.Second || d > time.Second {
+		t.Errorf("GuessEpoch() = %v, want about %v", got, epoch)
+	}
+
+	// A timestamp spanning over 60 years does not fit between 2000 and now.
+	old := []ID{ids[0], DefaultLayout.pack(60*365*24*uint64(time.Hour/time.Millisecond), 0, 0, 0)}
+	if _, ok := GuessEpoch(old, DefaultLayout); ok {
+		t.Error("GuessEpoch() accepted IDs spanning 60 years")
+	}
+}
+
+func TestSameEpochWindow(t *testing.T) {
+	epoch := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	recent, err := NewWithOptions(1, WithEpoch(epoch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []ID{recent.NextID(), recent.NextID()}
+	if err := SameEpochWindow(ids, epoch, DefaultLayout); err != nil {
+		t.Errorf("SameEpochWindow() = %v for IDs of one epoch", err)
+	}
+
+	// Under the 2024 epoch, an ID of the default 2015 epoch dates from
+	// the future.
+	foreign := New(2).NextID()
+	ids = append(ids, foreign, recent.NextID())
+	err = SameEpochWindow(ids, epoch, DefaultLayout)
+	if err == nil {
+		t.Fatal("SameEpochWindow() accepted IDs of two epochs")
+	}
+	if want := "ID " + strconv.FormatUint(uint64(foreign), 10) + " at index 2"; !strings.Contains(err.Error(), want) {
+		t.Errorf("error = %q, want it to mention %q", err, want)
+	}
+}
@@ -0,0 +1,429 @@
+package flake
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Encoding identifies a way of representing an ID
+type Encoding int
+
+// Supported encodings
+const (
+	Binary  Encoding = iota // 8 bytes, big endian
+	Decimal                 // decimal digits
+	Base36                  // lowercase base36, as returned by ID.String
+	Base62                  // digits and upper and lower case letters
+	Hex                     // lowercase hexadecimal
+)
+
+// maxLen returns the longest encoded form of an ID in bytes, or 0 for an
+// unknown encoding.
+func (e Encoding) maxLen() int {
+	switch e {
+	case Binary:
+		return 8
+	case Decimal:
+		return 20
+	case Base36:
+		return 13
+	case Base62:
+		return 11
+	case Hex:
+		return 16
+	}
+	return 0
+}
+
+// format formats id in the encoding, which must not be Binary.
+func (e Encoding) format(id ID) string {
+	switch e {
+	case Decimal:
+		return strconv.FormatUint(uint64(id), 10)
+	case Base62:
+		return id.Base62()
+	case Hex:
+		return id.Hex()
+	}
+	return id.String()
+}
+
+// parse parses an ID formatted by format.
+func (e Encoding) parse(s string) (ID, error) {
+	switch e {
+	case Decimal:
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid ID %q", s)
+		}
+		return ID(n), nil
+	case Base62:
+		return ParseBase62(s)
+	case Hex:
+		n, err := strconv.ParseUint(s, 16, 64)
+		if err != nil || len(s) != 16 {
+			return 0, fmt.Errorf("invalid hex ID %q", s)
+		}
+		return ID(n), nil
+	}
+	return Parse(s)
+}
+
+// describedPrefixes maps the string encodings to the prefixes of Describe.
+var describedPrefixes = map[Encoding]string{
+	Decimal: "f10:",
+	Base36:  "f36:",
+	Base62:  "f62:",
+	Hex:     "f16:",
+}
+
+// Describe formats the ID in the given encoding behind a prefix naming the
+// encoding, as in f36:3f8eq5ktp0ah or f16:0226bd7a10c00001, so that IDs in
+// different encodings can be told apart. It panics for Binary.
+func (id ID) Describe(e Encoding) string {
+	prefix, ok := describedPrefixes[e]
+	if !ok {
+		panic("flake: encoding cannot be described")
+	}
+	return prefix + e.format(id)
+}
+
+// ParseDescribed parses an ID formatted by ID.Describe in any encoding
+func ParseDescribed(s string) (ID, error) {
+	for e, prefix := range describedPrefixes {
+		if rest, ok := strings.CutPrefix(s, prefix); ok {
+			return e.parse(rest)
+		}
+	}
+	return 0, fmt.Errorf("invalid described ID %q: unknown prefix", s)
+}
+
+// StorageBytes returns the number of bytes needed to store n IDs in the given
+// encoding, assuming every ID takes the longest form of the encoding
+func StorageBytes(n int, encoding Encoding) int {
+	return n * encoding.maxLen()
+}
+
+const base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// Base62 formats the ID in base62, using digits and upper and lower case
+// letters
+func (id ID) Base62() string {
+	var b [11]byte
+	i := len(b)
+	for n := uint64(id); ; n /= 62 {
+		i--
+		b[i] = base62Alphabet[n%62]
+		if n < 62 {
+			break
+		}
+	}
+	return string(b[i:])
+}
+
+// ParseBase62 parses the base62 form of an ID returned by ID.Base62
+func ParseBase62(s string) (ID, error) {
+	if s == "" || len(s) > 11 {
+		return 0, fmt.Errorf("invalid base62 ID %q", s)
+	}
+	var n uint64
+	for i := 0; i < len(s); i++ {
+		d := strings.IndexByte(base62Alphabet, s[i])
+		if d < 0 || n > (math.MaxUint64-uint64(d))/62 {
+			return 0, fmt.Errorf("invalid base62 ID %q", s)
+		}
+		n = n*62 + uint64(d)
+	}
+	return ID(n), nil
+}
+
+// Slug formats the ID as a URL path segment made of label and the base62 form
+// of the ID, as in my-first-post-2Nj4hQx0Tq1. The label is lowercased and
+// every run of characters other than ASCII letters and digits becomes a single
+// hyphen, so a label without any of them leaves only the ID.
+func (id ID) Slug(label string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(label) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			hyphen = false
+		} else {
+			hyphen = true
+		}
+	}
+	if b.Len() > 0 {
+		b.WriteByte('-')
+	}
+	b.WriteString(id.Base62())
+	return b.String()
+}
+
+// ParseSlug parses the ID of a slug returned by ID.Slug, ignoring the label
+func ParseSlug(s string) (ID, error) {
+	return ParseBase62(s[strings.LastIndexByte(s, '-')+1:])
+}
+
+// Hex formats the ID as 16 lowercase hexadecimal digits
+func (id ID) Hex() string {
+	return fmt.Sprintf("%016x", uint64(id))
+}
+
+// Sortable formats an ID with the default layout as its UTC creation time,
+// worker id and sequence, as in 20240601T130405.123Z-0001-00a3. The strings
+// sort in the same order as the IDs.
+func (id ID) Sortable() string {
+	return fmt.Sprintf("%s-%04x-%04x", id.Time().Format("20060102T150405.000Z"),
+		id.WorkerID(), DefaultLayout.sequence(id))
+}
+
+// MarshalText implements encoding.TextMarshaler, using the base36 form
+func (id ID) MarshalText() ([]byte, error) {
+	return id.AppendText(nil)
+}
+
+// AppendText implements encoding.TextAppender, appending the base36 form
+func (id ID) AppendText(b []byte) ([]byte, error) {
+	return strconv.AppendUint(b, uint64(id), 36), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, parsing the base36 form
+func (id *ID) UnmarshalText(b []byte) error {
+	v, err := Parse(string(b))
+	if err != nil {
+		return err
+	}
+	*id = v
+	return nil
+}
+
+// FormattedID is an ID bound to the generator that formats it, so that its
+// String method and its text and JSON encodings use the prefix, format and
+// check character of the generator, like Flake.Format. Decoding one needs the
+// generator too: unmarshal into a FormattedID returned by Flake.Formatted.
+type FormattedID struct {
+	ID ID
+	f  *Flake
+}
+
+// Formatted binds id to the generator
+func (f *Flake) Formatted(id ID) FormattedID {
+	return FormattedID{ID: id, f: f}
+}
+
+// NextFormattedID returns a new ID from the generator bound to it
+func (f *Flake) NextFormattedID() FormattedID {
+	return f.Formatted(f.NextID())
+}
+
+// String formats the ID like Flake.Format
+func (id FormattedID) String() string {
+	return id.f.Format(id.ID)
+}
+
+// MarshalText implements encoding.TextMarshaler, formatting the ID like
+// Flake.Format
+func (id FormattedID) MarshalText() ([]byte, error) {
+	return []byte(id.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, parsing the ID like
+// Flake.Parse
+func (id *FormattedID) UnmarshalText(b []byte) error {
+	if id.f == nil {
+		return errors.New("FormattedID has no generator to parse with")
+	}
+	v, err := id.f.Parse(string(b))
+	if err != nil {
+		return err
+	}
+	id.ID = v
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler, using 8 big-endian
+// bytes
+func (id ID) MarshalBinary() ([]byte, error) {
+	return id.AppendBinary(make([]byte, 0, 8))
+}
+
+// AppendBinary implements encoding.BinaryAppender, appending 8 big-endian
+// bytes
+func (id ID) AppendBinary(b []byte) ([]byte, error) {
+	return binary.BigEndian.AppendUint64(b, uint64(id)), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler
+func (id *ID) UnmarshalBinary(b []byte) error {
+	if len(b) != 8 {
+		return fmt.Errorf("invalid binary ID of %d bytes", len(b))
+	}
+	*id = ID(binary.BigEndian.Uint64(b))
+	return nil
+}
+
+// Split returns the high and low 32 bits of the ID, for storage in two 32-bit
+// columns
+func (id ID) Split() (hi, lo uint32) {
+	return uint32(id >> 32), uint32(id)
+}
+
+// Join reassembles an ID from the halves returned by Split
+func Join(hi, lo uint32) ID {
+	return ID(hi)<<32 | ID(lo)
+}
+
+// EncodeDelta encodes ids as the first ID in 8 big-endian bytes followed by
+// the difference of every other ID to its predecessor as a varint. IDs sorted
+// in ascending order take a few bytes each; unsorted IDs still decode
+// correctly, but take up to 10 bytes each.
+func EncodeDelta(ids []ID) []byte {
+	if len(ids) == 0 {
+		return nil
+	}
+	b := binary.BigEndian.AppendUint64(make([]byte, 0, 8+2*len(ids)), uint64(ids[0]))
+	for i := 1; i < len(ids); i++ {
+		b = binary.AppendUvarint(b, uint64(ids[i]-ids[i-1]))
+	}
+	return b
+}
+
+// DecodeDelta decodes IDs encoded by EncodeDelta
+func DecodeDelta(b []byte) ([]ID, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+	if len(b) < 8 {
+		return nil, errors.New("delta encoding is too short")
+	}
+	ids := []ID{ID(binary.BigEndian.Uint64(b))}
+	for b = b[8:]; len(b) > 0; {
+		delta, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errors.New("invalid delta in delta encoding")
+		}
+		ids = append(ids, ids[len(ids)-1]+ID(delta))
+		b = b[n:]
+	}
+	return ids, nil
+}
+
+// Parse parses the base36 form of an ID returned by ID.String
+func Parse(s string) (ID, error) {
+	n, err := strconv.ParseUint(s, 36, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ID %q", s)
+	}
+	return ID(n), nil
+}
+
+// ParseLoose is like Parse but first trims surrounding whitespace and a single
+// pair of matching double or single quotes, as found around IDs copied from
+// JSON or logs
+func ParseLoose(s string) (ID, error) {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		s = s[1 : len(s)-1]
+	}
+	return Parse(s)
+}
+
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// CrockfordBase32 formats the ID in Crockford's base32, which leaves out the
+// easily confused letters I, L, O and U
+func (id ID) CrockfordBase32() string {
+	var b [13]byte
+	i := len(b)
+	for n := uint64(id); ; n >>= 5 {
+		i--
+		b[i] = crockfordAlphabet[n&31]
+		if n < 32 {
+			break
+		}
+	}
+	return string(b[i:])
+}
+
+// ParseCrockfordBase32 parses an ID in Crockford's base32. Decoding is case
+// insensitive, reads I and L as 1 and O as 0, and ignores hyphens.
+func ParseCrockfordBase32(s string) (ID, error) {
+	var n uint64
+	digits := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '-' {
+			continue
+		}
+		d := crockfordDigit(c)
+		if d < 0 || n>>59 != 0 {
+			return 0, fmt.Errorf("invalid Crockford base32 ID %q", s)
+		}
+		n = n<<5 | uint64(d)
+		digits++
+	}
+	if digits == 0 {
+		return 0, fmt.Errorf("invalid Crockford base32 ID %q", s)
+	}
+	return ID(n), nil
+}
+
+// crockfordDigit returns the value of a Crockford base32 character, or -1.
+func crockfordDigit(c byte) int {
+	if c >= 'a' && c <= 'z' {
+		c -= 'a' - 'A'
+	}
+	switch c {
+	case 'I', 'L':
+		return 1
+	case 'O':
+		return 0
+	}
+	return strings.IndexByte(crockfordAlphabet, c)
+}
+
+// ToUUIDv7 lays out an ID generated with the default layout as a version 7
+// UUID. The first 48 bits hold the Unix time of the ID in milliseconds, and
+// the 23 worker and sequence bits follow the version and variant bits. The
+// remaining bits are zero.
+func (id ID) ToUUIDv7() [16]byte {
+	var u [16]byte
+	ms := uint64(id.Time().UnixMilli())
+	low := uint64(id) & (MaxWorkerID<<SequenceBits | MaxSequence)
+
+	binary.BigEndian.PutUint64(u[0:], ms<<16|0x7<<12|low>>11)
+	binary.BigEndian.PutUint64(u[8:], 0x2<<62|(low&0x7ff)<<51)
+	return u
+}
+
+// FromUUIDv7 converts a UUID returned by ToUUIDv7 back into an ID
+func FromUUIDv7(u [16]byte) (ID, error) {
+	hi := binary.BigEndian.Uint64(u[0:])
+	lo := binary.BigEndian.Uint64(u[8:])
+	if hi>>12&0xf != 7 || lo>>62 != 2 {
+		return 0, errors.New("not a version 7 UUID")
+	}
+	if lo&(1<<51-1) != 0 {
+		return 0, errors.New("UUID was not created by ToUUIDv7")
+	}
+
+	t := time.UnixMilli(int64(hi >> 16))
+	if t.Before(Epoch) {
+		return 0, errors.New("UUID time is before the epoch")
+	}
+	timestamp := uint64(t.Sub(Epoch) / time.Millisecond)
+	if timestamp > DefaultLayout.maxTimestamp() {
+		return 0, errors.New("UUID time does not fit the timestamp bits")
+	}
+
+	low := (hi&0xfff)<<11 | lo>>51&0x7ff
+	return ID(timestamp<<(HostBits+SequenceBits) | low), nil
+}
@@ -0,0 +1,377 @@
+package flake
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	id := New(1).NextID()
+	got, err := Parse(id.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != id {
+		t.Errorf("Parse(%q) = %d, want %d", id.String(), got, id)
+	}
+}
+
+func TestParseLoose(t *testing.T) {
+	want, _ := Parse("abc123")
+	for _, s := range []string{`"abc123"`, ` abc123 `, "'abc123'", "\t\"abc123\"\n"} {
+		got, err := ParseLoose(s)
+		if err != nil {
+			t.Errorf("ParseLoose(%q) error: %v", s, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("ParseLoose(%q) = %d, want %d", s, got, want)
+		}
+	}
+
+	for _, s := range []string{`"abc 123"`, `"abc123'`, `abc-123`, `""`} {
+		if _, err := ParseLoose(s); err == nil {
+			t.Errorf("ParseLoose(%q) expected an error", s)
+		}
+	}
+}
+
+func TestStorageBytes(t *testing.T) {
+	if got := StorageBytes(1000, Binary); got != 8000 {
+		t.Errorf("StorageBytes(1000, Binary) = %d, want 8000", got)
+	}
+
+	width := len(ID(math.MaxUint64).String())
+	if got := StorageBytes(1000, Base36); got != 1000*width {
+		t.Errorf("StorageBytes(1000, Base36) = %d, want %d", got, 1000*width)
+	}
+	if got := StorageBytes(1, Decimal); got != len(strconv.FormatUint(math.MaxUint64, 10)) {
+		t.Errorf("StorageBytes(1, Decimal) = %d", got)
+	}
+	if got := StorageBytes(1, Hex); got != 16 {
+		t.Errorf("StorageBytes(1, Hex) = %d, want 16", got)
+	}
+}
+
+func TestCrockfordBase32(t *testing.T) {
+	for _, id := range []ID{0, 31, 32, New(1).NextID(), math.MaxUint64} {
+		s := id.CrockfordBase32()
+		got, err := ParseCrockfordBase32(s)
+		if err != nil {
+			t.Errorf("ParseCrockfordBase32(%q) error: %v", s, err)
+			continue
+		}
+		if got != id {
+			t.Errorf("ParseCrockfordBase32(%q) = %d, want %d", s, got, id)
+		}
+	}
+
+	tests := []struct {
+		s    string
+		want ID
+	}{
+		{"ZZ", 1023},
+		{"zz", 1023},
+		{"Zz", 1023},
+		{"1O", 32},
+		{"io", 32},
+		{"L0", 32},
+		{"1-0", 32},
+	}
+	for _, tt := range tests {
+		got, err := ParseCrockfordBase32(tt.s)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseCrockfordBase32(%q) = %d, %v, want %d", tt.s, got, err, tt.want)
+		}
+	}
+
+	for _, s := range []string{"", "U", "1*", "FZZZZZZZZZZZZZ", "-"} {
+		if _, err := ParseCrockfordBase32(s); err == nil {
+			t.Errorf("ParseCrockfordBase32(%q) expected an error", s)
+		}
+	}
+}
+
+func TestSplitJoin(t *testing.T) {
+	for _, id := range []ID{0, 1, math.MaxUint32, math.MaxUint32 + 1, New(1).NextID(), 1 << 63, math.MaxUint64} {
+		hi, lo := id.Split()
+		if got := Join(hi, lo); got != id {
+			t.Errorf("Join(%d.Split()) = %d", id, got)
+		}
+	}
+
+	if hi, lo := ID(0xdeadbeef00c0ffee).Split(); hi != 0xdeadbeef || lo != 0x00c0ffee {
+		t.Errorf("Split() = %#x, %#x, want 0xdeadbeef, 0xc0ffee", hi, lo)
+	}
+}
+
+func TestUUIDv7(t *testing.T) {
+	at := time.Date(2024, 6, 1, 13, 4, 5, 678e6, time.UTC)
+	id := DefaultLayout.pack(uint64(at.Sub(Epoch)/time.Millisecond), 0, MaxWorkerID, 4321)
+
+	u := id.ToUUIDv7()
+	if version := u[6] >> 4; version != 7 {
+		t.Errorf("version = %d, want 7", version)
+	}
+	if variant := u[8] >> 6; variant != 2 {
+		t.Errorf("variant = %b, want 10", variant)
+	}
+	var ms [8]byte
+	copy(ms[2:], u[:6])
+	if got := int64(binary.BigEndian.Uint64(ms[:])); got != at.UnixMilli() {
+		t.Errorf("timestamp = %d, want %d", got, at.UnixMilli())
+	}
+
+	got, err := FromUUIDv7(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != id {
+		t.Errorf("FromUUIDv7() = %d, want %d", got, id)
+	}
+
+	u[6] = 0x40
+	if _, err := FromUUIDv7(u); err == nil {
+		t.Error("FromUUIDv7() accepted a version 4 UUID")
+	}
+}
+
+func TestUUIDv7Sorts(t *testing.T) {
+	f := New(1)
+	prev := f.NextID().ToUUIDv7()
+	for i := 0; i < 100; i++ {
+		u := f.NextID().ToUUIDv7()
+		if string(u[:]) <= string(prev[:]) {
+			t.Fatalf("UUID %x does not sort after %x", u, prev)
+		}
+		prev = u
+	}
+}
+
+func TestHex(t *testing.T) {
+	if got := ID(0xabc).Hex(); got != "0000000000000abc" {
+		t.Errorf("Hex() = %q, want 0000000000000abc", got)
+	}
+}
+
+func TestSortable(t *testing.T) {
+	at := time.Date(2024, 6, 1, 13, 4, 5, 123e6, time.UTC)
+	id := DefaultLayout.pack(uint64(at.Sub(Epoch)/time.Millisecond), 0, 1, 0xa3)
+	if got, want := id.Sortable(), "20240601T130405.123Z-0001-00a3"; got != want {
+		t.Errorf("Sortable() = %q, want %q", got, want)
+	}
+
+	ids := []ID{id, id + 1, id + 1<<SequenceBits, FirstIDAt(at.Add(time.Millisecond)), FirstIDAt(at.AddDate(1, 0, 0))}
+	for _, w := range []uint64{0, 1, MaxWorkerID} {
+		ids = append(ids, DefaultLayout.pack(uint64(at.Sub(Epoch)/time.Millisecond), 0, w, MaxSequence))
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for i := 1; i < len(ids); i++ {
+		if a, b := ids[i-1].Sortable(), ids[i].Sortable(); a >= b {
+			t.Errorf("%q does not sort before %q", a, b)
+		}
+	}
+}
+
+func TestBase62(t *testing.T) {
+	for _, id := range []ID{0, 61, 62, New(1).NextID(), math.MaxUint64} {
+		s := id.Base62()
+		got, err := ParseBase62(s)
+		if err != nil || got != id {
+			t.Errorf("ParseBase62(%q) = %d, %v, want %d", s, got, err, id)
+		}
+	}
+	if got := ID(62).Base62(); got != "10" {
+		t.Errorf("ID(62).Base62() = %q, want 10", got)
+	}
+
+	for _, s := range []string{"", "abc-", "LygHa16AHYG", "zzzzzzzzzzz", "000000000000"} {
+		if _, err := ParseBase62(s); err == nil {
+			t.Errorf("ParseBase62(%q) expected an error", s)
+		}
+	}
+}
+
+func TestSlug(t *testing.T) {
+	id := New(1).NextID()
+	tests := []struct {
+		label string
+		want  string
+	}{
+		{"My First Post", "my-first-post-"},
+		{"  pre-existing--hyphens- ", "pre-existing-hyphens-"},
+		{"Grüße aus Köln!", "gr-e-aus-k-ln-"},
+		{"日本語", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		s := id.Slug(tt.label)
+		if want := tt.want + id.Base62(); s != want {
+			t.Errorf("Slug(%q) = %q, want %q", tt.label, s, want)
+		}
+		got, err := ParseSlug(s)
+		if err != nil {
+			t.Errorf("ParseSlug(%q) error: %v", s, err)
+			continue
+		}
+		if got != id {
+			t.Errorf("ParseSlug(%q) = %d, want %d", s, got, id)
+		}
+	}
+
+	for _, s := range []string{"", "post-", "post-not_base62"} {
+		if _, err := ParseSlug(s); err == nil {
+			t.Errorf("ParseSlug(%q) did not fail", s)
+		}
+	}
+}
+
+func TestDelta(t *testing.T) {
+	f := New(1)
+	ids := make([]ID, 1000)
+	for i := range ids {
+		ids[i] = f.NextID()
+	}
+
+	b := EncodeDelta(ids)
+	if len(b) >= 8*len(ids) {
+		t.Errorf("EncodeDelta() took %d bytes, want less than %d", len(b), 8*len(ids))
+	}
+	got, err := DecodeDelta(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, ids) {
+		t.Error("DecodeDelta() does not return the encoded IDs")
+	}
+
+	unsorted := []ID{5, math.MaxUint64, 0, 3}
+	if got, err := DecodeDelta(EncodeDelta(unsorted)); err != nil || !slices.Equal(got, unsorted) {
+		t.Errorf("DecodeDelta() of unsorted IDs = %v, %v, want %v", got, err, unsorted)
+	}
+	if got, err := DecodeDelta(nil); err != nil || len(got) != 0 {
+		t.Errorf("DecodeDelta(nil) = %v, %v, want no IDs", got, err)
+	}
+
+	for _, b := range [][]byte{{1, 2, 3}, append(EncodeDelta(ids[:1]), 0x80)} {
+		if _, err := DecodeDelta(b); err == nil {
+			t.Errorf("DecodeDelta(%x) did not fail", b)
+		}
+	}
+}
+
+var (
+	_ encoding.TextAppender   = ID(0)
+	_ encoding.BinaryAppender = ID(0)
+)
+
+func TestAppendTextBinary(t *testing.T) {
+	id := New(1).NextID()
+	prefix := []byte("id=")
+
+	text, err := id.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(text) != id.String() {
+		t.Errorf("MarshalText() = %q, want %q", text, id.String())
+	}
+	if got, err := id.AppendText(prefix[:len(prefix):len(prefix)]); err != nil || !bytes.Equal(got, append(prefix, text...)) {
+		t.Errorf("AppendText() = %q, %v, want %q", got, err, append(prefix, text...))
+	}
+
+	bin, err := id.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := id.AppendBinary(prefix[:len(prefix):len(prefix)]); err != nil || !bytes.Equal(got, append(prefix, bin...)) {
+		t.Errorf("AppendBinary() = %x, %v, want %x", got, err, append(prefix, bin...))
+	}
+
+	var fromText, fromBinary ID
+	if err := fromText.UnmarshalText(text); err != nil || fromText != id {
+		t.Errorf("UnmarshalText(%q) = %d, %v, want %d", text, fromText, err, id)
+	}
+	if err := fromBinary.UnmarshalBinary(bin); err != nil || fromBinary != id {
+		t.Errorf("UnmarshalBinary(%x) = %d, %v, want %d", bin, fromBinary, err, id)
+	}
+	if err := fromBinary.UnmarshalBinary(bin[:7]); err == nil {
+		t.Error("UnmarshalBinary() accepted 7 bytes")
+	}
+
+	buf := make([]byte, 0, 64)
+	if allocs := testing.AllocsPerRun(100, func() {
+		buf, _ = id.AppendText(buf[:0])
+		buf, _ = id.AppendBinary(buf)
+	}); allocs != 0 {
+		t.Errorf("AppendText and AppendBinary allocate %v times, want 0", allocs)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	id := New(1).NextID()
+	tests := []struct {
+		e    Encoding
+		want string
+	}{
+		{Decimal, "f10:" + strconv.FormatUint(uint64(id), 10)},
+		{Base36, "f36:" + id.String()},
+		{Base62, "f62:" + id.Base62()},
+		{Hex, "f16:" + id.Hex()},
+	}
+	for _, tt := range tests {
+		s := id.Describe(tt.e)
+		if s != tt.want {
+			t.Errorf("Describe(%d) = %q, want %q", tt.e, s, tt.want)
+		}
+		if got, err := ParseDescribed(s); err != nil || got != id {
+			t.Errorf("ParseDescribed(%q) = %d, %v, want %d", s, got, err, id)
+		}
+	}
+
+	for _, s := range []string{"f32:abc", id.String(), "f16:xyz", ""} {
+		if _, err := ParseDescribed(s); err == nil {
+			t.Errorf("ParseDescribed(%q) did not fail", s)
+		}
+	}
+}
+
+func TestFormattedID(t *testing.T) {
+	f, err := NewWithOptions(1, WithDefaultFormat(Hex), WithStringPrefix("ord_"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := f.NextFormattedID()
+	if got, want := id.String(), "ord_"+id.ID.Hex(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	b, err := json.Marshal(struct{ ID FormattedID }{id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), `{"ID":"ord_`+id.ID.Hex()+`"}`; got != want {
+		t.Errorf("json.Marshal() = %s, want %s", got, want)
+	}
+
+	decoded := struct{ ID FormattedID }{f.Formatted(0)}
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.ID.ID != id.ID {
+		t.Errorf("json.Unmarshal() = %d, want %d", decoded.ID.ID, id.ID)
+	}
+
+	var unbound FormattedID
+	if err := unbound.UnmarshalText([]byte(id.String())); err == nil {
+		t.Error("UnmarshalText() without a generator expected an error")
+	}
+}
@@ -3,6 +3,9 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
+	"os"
+	"time"
 
 	"github.com/nordligulv/go-flake"
 )
@@ -11,12 +14,18 @@ var (
 	max     = flag.Int("max", 1, "number of IDs to create")
 	hex     = flag.Bool("hex", false, "Show hex representation")
 	integer = flag.Bool("integer", false, "Show integer representation")
+	bench   = flag.Duration("bench", 0, "Generate IDs for the given duration and report the throughput")
 )
 
 func main() {
 	flag.Parse()
 	f := flake.New(1)
 
+	if *bench > 0 {
+		runBench(os.Stdout, f, *bench)
+		return
+	}
+
 	if !*hex && !*integer {
 		*hex = true
 	}
@@ -33,3 +42,29 @@ func main() {
 		}
 	}
 }
+
+// runBench generates IDs as fast as possible for d and writes a summary to w.
+// IDs from one generator increase, so an ID not above its predecessor is
+// counted as a duplicate.
+func runBench(w io.Writer, f *flake.Flake, d time.Duration) {
+	var n, dups int
+	var prev flake.ID
+	start := time.Now()
+	deadline := start.Add(d)
+	for {
+		for i := 0; i < 1024; i++ {
+			id := f.NextID()
+			if id <= prev {
+				dups++
+			}
+			prev = id
+		}
+		n += 1024
+		if !time.Now().Before(deadline) {
+			break
+		}
+	}
+	elapsed := time.Since(start)
+	fmt.Fprintf(w, "%d IDs in %v: %.0f IDs/sec, %d duplicates\n",
+		n, elapsed.Round(time.Millisecond), float64(n)/elapsed.Seconds(), dups)
+}
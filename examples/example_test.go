@@ -0,0 +1,20 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/nordligulv/go-flake"
+)
+
+func TestRunBench(t *testing.T) {
+	var buf bytes.Buffer
+	runBench(&buf, flake.New(1), 10*time.Millisecond)
+
+	summary := regexp.MustCompile(`^\d+ IDs in \d+ms: \d+ IDs/sec, 0 duplicates\n$`)
+	if !summary.Match(buf.Bytes()) {
+		t.Errorf("summary = %q, want it to match %v", buf.String(), summary)
+	}
+}
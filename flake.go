@@ -13,19 +13,33 @@
 package flake
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"math"
+	mathrand "math/rand/v2"
 	"net"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const (
-	HostBits     = 10
-	SequenceBits = 13
+	TimestampBits = 41
+	HostBits      = 10
+	SequenceBits  = 13
+
+	// readyInterval and readyTolerance control how WaitUntilReady samples
+	// the clock.
+	readyInterval  = 10 * time.Millisecond
+	readyTolerance = 100 * time.Millisecond
 )
 
 var (
@@ -33,6 +47,35 @@ var (
 	Epoch              = time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
 	MaxWorkerID uint64 = (1 << HostBits) - 1
 	MaxSequence uint64 = (1 << SequenceBits) - 1
+
+	// ErrInvalidConfig is returned by NewWithOptions when the options do not
+	// describe a usable generator. The returned error wraps ErrInvalidConfig
+	// and describes the problem.
+	ErrInvalidConfig = errors.New("invalid config")
+
+	// ErrClockBackwards is returned by NextIDContext when the clock moved
+	// backwards by more than the configured tolerance.
+	ErrClockBackwards = errors.New("clock moved backwards")
+
+	// ErrBeforeEpoch is returned by NextIDContext when the clock is before the
+	// epoch, and wrapped by NewWithOptions for an epoch in the future.
+	ErrBeforeEpoch = errors.New("clock is before the epoch")
+
+	// ErrClockStuck is returned by NextIDContext when the clock stopped
+	// advancing while the generator moved on by more than the threshold set
+	// with WithStuckClockDetection.
+	ErrClockStuck = errors.New("clock is not advancing")
+
+	// ErrInvalidTag is returned when a tag does not fit the layout's tag bits.
+	ErrInvalidTag = errors.New("tag exceeds the reserved tag bits")
+
+	// ErrInvalidShard is returned when a shard does not fit the layout's
+	// worker bits.
+	ErrInvalidShard = errors.New("shard exceeds the worker bits")
+
+	// ErrInvalidPriority is returned when a priority does not fit the
+	// reserved priority bits.
+	ErrInvalidPriority = errors.New("priority exceeds the reserved priority bits")
 )
 
 // ID represents a unique k-ordered ID
@@ -48,20 +91,255 @@ func (id ID) Uint64() uint64 {
 	return uint64(id)
 }
 
+// Int64 returns the ID as a signed integer, for int64 columns and APIs. IDs
+// with the default layout and epoch keep the top bit unset until late 2049;
+// Int64 returns an error for IDs with the top bit set rather than a negative
+// value.
+func (id ID) Int64() (int64, error) {
+	if id > math.MaxInt64 {
+		return 0, fmt.Errorf("ID %d does not fit in an int64", uint64(id))
+	}
+	return int64(id), nil
+}
+
+// FromInt64 converts a signed integer returned by ID.Int64 back into an ID.
+// It returns an error for negative values.
+func FromInt64(v int64) (ID, error) {
+	if v < 0 {
+		return 0, fmt.Errorf("negative value %d is not an ID", v)
+	}
+	return ID(v), nil
+}
+
+// WorkerID returns the worker id of an ID generated with the default layout
+func (id ID) WorkerID() uint64 {
+	return DefaultLayout.worker(id)
+}
+
+// WorkerHighBits returns the top n bits of the worker id of an ID generated
+// with the default layout, such as a rack or zone encoded in front of the
+// machine number. It panics if n exceeds HostBits.
+func (id ID) WorkerHighBits(n uint) uint64 {
+	if n > HostBits {
+		panic("flake: more high bits requested than the worker id has")
+	}
+	return id.WorkerID() >> (HostBits - n)
+}
+
+// Sequence returns the sequence number of an ID generated with the default
+// layout
+func (id ID) Sequence() uint64 {
+	return DefaultLayout.sequence(id)
+}
+
+// Ordinal returns the position of an ID generated with the default layout
+// among the IDs of its worker and millisecond. It is the same as Sequence.
+func (id ID) Ordinal() uint64 {
+	return id.Sequence()
+}
+
+// LogicalClock returns the timestamp and sequence number of an ID with the
+// default layout combined into one number, leaving out the worker id. It
+// increases with every ID of a worker, and so orders the IDs of one worker
+// like a Lamport clock.
+func (id ID) LogicalClock() uint64 {
+	return DefaultLayout.timestamp(id)*(MaxSequence+1) + id.Sequence()
+}
+
+// SameWorker reports whether two IDs were generated by the same worker
+func (id ID) SameWorker(other ID) bool {
+	return id.WorkerID() == other.WorkerID()
+}
+
+// Concurrent reports whether two IDs with the default layout were generated
+// by different workers in the same millisecond. Their order says nothing about
+// which was generated first.
+func (id ID) Concurrent(other ID) bool {
+	return DefaultLayout.timestamp(id) == DefaultLayout.timestamp(other) && !id.SameWorker(other)
+}
+
+// Prefix returns id with its sequence bits cleared, so IDs generated by the
+// same worker in the same millisecond share a prefix
+func (id ID) Prefix() ID {
+	return id &^ ID(MaxSequence)
+}
+
+// Next returns the ID numerically following id, for use as an exclusive range
+// bound. The largest ID is returned unchanged.
+func (id ID) Next() ID {
+	if id == math.MaxUint64 {
+		return id
+	}
+	return id + 1
+}
+
+// Prev returns the ID numerically preceding id. The zero ID is returned
+// unchanged.
+func (id ID) Prev() ID {
+	if id == 0 {
+		return id
+	}
+	return id - 1
+}
+
+// Time returns the creation time in UTC of an ID generated with the default
+// layout
+func (id ID) Time() time.Time {
+	return Epoch.Add(time.Duration(DefaultLayout.timestamp(id)) * time.Millisecond).UTC()
+}
+
+// ExpiredAfter reports whether more than ttl has passed since an ID with the
+// default layout was created. IDs dated in the future, as generated by a
+// worker whose clock is ahead, are not expired.
+func (id ID) ExpiredAfter(ttl time.Duration) bool {
+	return id.Time().Add(ttl).Before(time.Now())
+}
+
 // Flake is a unique ID generator
 type Flake struct {
-	prevTime uint64
-	workerID uint64
-	sequence uint64
-	mu       sync.Mutex
+	workerID   atomic.Uint64
+	layout     Layout
+	epoch      time.Time
+	started    time.Time
+	now        func() time.Time
+	descending bool
+	randomSeq  bool
+	nolock     bool
+	forbidZero bool
+	remapZero  bool
+	saltBits   uint
+	prioBits   uint
+	salt       uint64
+	tolerance  time.Duration
+	stuckAfter time.Duration
+	catchUp    bool
+	counter    bool
+	prefix     string
+	format     Encoding
+	checked    bool
+	replay     io.Writer
+	crashPath  string
+	crashEvery time.Duration
+	crash      *crashMarker
+	refresh    *workerRefresh
+	replayMu   sync.Mutex
+	sleep      func(context.Context, time.Duration) error
+	rateLimit  int
+	limiter    *limiter
+	unit       time.Duration
+	resolution time.Duration
+	pid        atomic.Int64
+	getpid     func() int
+	forkMu     sync.Mutex
+	shardCount int
+	shards     []*shard
+	nextShard  atomic.Uint64
+}
+
+// shard owns the sequence numbers first through last. A generator has a single
+// shard covering the whole sequence space unless WithSequenceShards is used.
+type shard struct {
+	mu        sync.Mutex
+	prevTime  uint64
+	lastClock uint64
+	sequence  uint64
+	first     uint64
+	last      uint64
+
+	// Counters reported by Stats.
+	generated uint64
+	overflows uint64
+	backwards uint64
+
+	// The last clock reading in Unix nanoseconds and the number of overflows
+	// when it was first seen, for WithStuckClockDetection.
+	seenClock     int64
+	seenOverflows uint64
 }
 
 // New returns new ID generator
 func New(workerID uint64) *Flake {
-	return &Flake{
-		sequence: 0,
-		prevTime: getTimestamp(),
-		workerID: workerID % MaxWorkerID,
+	f := &Flake{
+		layout:     DefaultLayout,
+		epoch:      Epoch,
+		now:        time.Now,
+		sleep:      sleep,
+		shardCount: 1,
+		unit:       time.Millisecond,
+		resolution: time.Millisecond,
+		format:     Base36,
+	}
+	f.workerID.Store(workerID & MaxWorkerID)
+	f.init()
+	return f
+}
+
+// NewWithOptions returns new ID generator configured by opts
+func NewWithOptions(workerID uint64, opts ...Option) (*Flake, error) {
+	f := &Flake{
+		layout:     DefaultLayout,
+		epoch:      Epoch,
+		now:        time.Now,
+		sleep:      sleep,
+		shardCount: 1,
+		unit:       time.Millisecond,
+		resolution: time.Millisecond,
+		format:     Base36,
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	if err := f.validateConfig(); err != nil {
+		return nil, err
+	}
+	if f.saltBits > 0 {
+		salt, err := getRandomID()
+		if err != nil {
+			return nil, err
+		}
+		f.salt = salt & mask(f.saltBits) << (f.layout.SequenceBits - f.saltBits)
+	}
+	folded := f.layout.foldWorker(workerID)
+	if folded == 0 && f.forbidZero {
+		if !f.remapZero {
+			return nil, fmt.Errorf("%w: worker id %d folds to zero", ErrInvalidConfig, workerID)
+		}
+		if folded = f.layout.foldWorker(mix64(workerID)); folded == 0 {
+			folded = 1
+		}
+	}
+	f.workerID.Store(folded)
+	if f.getpid != nil {
+		f.pid.Store(int64(f.getpid()))
+	}
+	f.init()
+	if f.crashPath != "" {
+		if err := f.recoverCrash(); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// init splits the sequence space between the shards and starts their clocks.
+func (f *Flake) init() {
+	f.started = f.now()
+	now := f.getTimestamp()
+	size := (f.counterMax() + 1) / uint64(f.shardCount)
+	f.shards = make([]*shard, f.shardCount)
+	for i := range f.shards {
+		first := uint64(i) * size
+		// The sequence starts just below first, so that the first ID takes
+		// the sequence number first even while the clock has not moved
+		// since construction.
+		f.shards[i] = &shard{prevTime: now, lastClock: now, sequence: first - 1, first: first, last: first + size - 1}
+	}
+	f.shards[len(f.shards)-1].last = f.counterMax()
+	if f.rateLimit > 0 {
+		f.limiter = newLimiter(f.rateLimit, f.now())
+	}
+	if f.refresh != nil {
+		f.refresh.due.Store(f.started.Add(f.refresh.interval).UnixNano())
 	}
 }
 
@@ -74,6 +352,16 @@ func WithHostID() (*Flake, error) {
 	return New(workerID), nil
 }
 
+// MustWithHostID is like WithHostID but panics if the host id cannot be
+// determined
+func MustWithHostID() *Flake {
+	f, err := WithHostID()
+	if err != nil {
+		panic("flake: " + err.Error())
+	}
+	return f
+}
+
 // WithRandomID creates new ID generator with random worker id
 func WithRandomID() (*Flake, error) {
 	workerID, err := getRandomID()
@@ -83,62 +371,645 @@ func WithRandomID() (*Flake, error) {
 	return New(workerID), nil
 }
 
-// NextID returns a new ID from the generator
+// NewCounter returns an ID generator for tests that never reads the real
+// clock. Its clock stands still at the epoch, and every ID moves on to the
+// next timestamp, so that consecutive calls to NextID yield IDs with
+// consecutive timestamps and sequence number zero.
+func NewCounter(workerID uint64) *Flake {
+	f := New(workerID)
+	f.now = func() time.Time { return f.epoch }
+	f.counter = true
+	f.started = f.epoch
+	for _, s := range f.shards {
+		s.prevTime, s.lastClock = 0, 0
+	}
+	return f
+}
+
+// NextID returns a new ID from the generator. If the clock moves backwards by
+// more than the configured tolerance, NextID keeps generating IDs from the
+// last timestamp it used until the clock catches up.
+//
+// A burst that exhausts the sequence numbers of a timestamp moves on to the
+// next timestamp ahead of the clock; once the clock passes the last timestamp
+// used, IDs carry the current time again. WithCatchUp makes NextID wait for
+// the clock instead of moving on ahead of it.
 func (f *Flake) NextID() ID {
-	now := getTimestamp()
+	id, _ := f.next(context.Background(), 0, ownWorker, 0, false)
+	return id
+}
+
+// NextIDContext is like NextID but returns ErrBeforeEpoch if the clock is
+// before the epoch, returns ErrClockBackwards if the clock moves backwards by
+// more than the configured tolerance, returns ErrClockStuck if the clock
+// stopped as described by WithStuckClockDetection, returns the errors of the
+// replay log, and
+// gives up waiting for the clock or the rate limit when ctx is done.
+func (f *Flake) NextIDContext(ctx context.Context) (ID, error) {
+	return f.next(ctx, 0, ownWorker, 0, true)
+}
+
+// Reserve reserves a block of n consecutive IDs and returns the first and
+// last of them. NextID never returns IDs of the block. The IDs share one
+// timestamp, so n must be between 1 and the number of sequence numbers per
+// timestamp, 8192 with the default layout; Reserve panics otherwise. The rate
+// limit counts the block as n IDs, and the replay log records its last ID,
+// ignoring write errors like NextID.
+func (f *Flake) Reserve(n int) (first ID, last ID) {
+	s := f.shard()
+	if n < 1 || uint64(n) > s.last-s.first+1 {
+		panic("flake: invalid number of IDs to reserve")
+	}
+	ctx := context.Background()
+	f.prepare(ctx, n)
+
+	step := uint64(f.resolution / f.unit)
+	now, _ := f.lockClock(ctx, s, false)
+	if f.catchUp {
+		now, _ = f.catchUpClock(ctx, s, now, step, uint64(n), false)
+	}
+	defer f.unlock(s)
+	if now <= s.prevTime && s.last-s.sequence < uint64(n) {
+		// The block does not fit in the current timestamp.
+		s.sequence = s.last
+	}
+	now, sequence := f.advance(s, now, step)
+	if s.last-sequence < uint64(n)-1 {
+		// A random first sequence number left too little room.
+		s.sequence = s.last
+		now, sequence = f.advance(s, now, step)
+	}
+	end := sequence + uint64(n) - 1
+	s.sequence = end
+	s.generated += uint64(n) - 1
+
+	if f.descending {
+		now = f.layout.maxTimestamp() - now
+	}
+	workerID := f.workerID.Load()
+	high := f.high(0)
+	first, last = f.layout.pack(now, 0, workerID, sequence|high), f.layout.pack(now, 0, workerID, end|high)
+	if f.replay != nil {
+		f.logID(last)
+	}
+	return first, last
+}
+
+// NextIDAtSecondBoundary waits until the start of the next wall-clock second
+// and returns an ID generated then, for batches aligned to whole seconds. The
+// ID falls into a later millisecond if the generator is ahead of the clock.
+// It returns the errors of NextIDContext and ctx.Err() if ctx is done first.
+func (f *Flake) NextIDAtSecondBoundary(ctx context.Context) (ID, error) {
+	now := f.now()
+	if err := f.sleep(ctx, now.Truncate(time.Second).Add(time.Second).Sub(now)); err != nil {
+		return 0, err
+	}
+	return f.NextIDContext(ctx)
+}
+
+// NextStringID returns a new ID from the generator formatted as a string
+// starting with the configured prefix
+func (f *Flake) NextStringID() string {
+	return f.Format(f.NextID())
+}
+
+// Format formats id like NextStringID, with the configured prefix, format and
+// check character
+func (f *Flake) Format(id ID) string {
+	s := f.format.format(id)
+	if f.checked {
+		s = appendCheckChar(s)
+	}
+	return f.prefix + s
+}
+
+// Parse parses a string returned by NextStringID
+func (f *Flake) Parse(s string) (ID, error) {
+	if !strings.HasPrefix(s, f.prefix) {
+		return 0, fmt.Errorf("invalid ID %q: missing prefix %q", s, f.prefix)
+	}
+	s = s[len(f.prefix):]
+	if f.checked {
+		var err error
+		if s, err = stripCheckChar(s); err != nil {
+			return 0, err
+		}
+	}
+	return f.format.parse(s)
+}
+
+// NextIDTagged returns a new ID carrying tag in the layout's tag bits
+func (f *Flake) NextIDTagged(tag uint64) (ID, error) {
+	if tag > f.layout.maxTag() {
+		return 0, ErrInvalidTag
+	}
+	id, _ := f.next(context.Background(), tag, ownWorker, 0, false)
+	return id, nil
+}
+
+// NextIDForShard returns a new ID carrying shard in place of the generator's
+// worker id, so the shard of a tenant can be read off its IDs without a
+// lookup. The worker field then no longer identifies the generator: IDs are
+// unique among the IDs of f, but two generators may generate the same ID for
+// the same shard.
+func (f *Flake) NextIDForShard(shard uint64) (ID, error) {
+	if shard > f.layout.maxWorker() {
+		return 0, ErrInvalidShard
+	}
+	id, _ := f.next(context.Background(), 0, shard, 0, false)
+	return id, nil
+}
+
+// NextIDPriority returns a new ID carrying priority in the priority bits
+// reserved by WithPriorityBits. Among the IDs of one timestamp, IDs with a
+// higher priority sort first; NextID uses priority zero.
+func (f *Flake) NextIDPriority(priority uint64) (ID, error) {
+	if priority > mask(f.prioBits) {
+		return 0, ErrInvalidPriority
+	}
+	id, _ := f.next(context.Background(), 0, ownWorker, priority, false)
+	return id, nil
+}
+
+// Iter returns an iterator yielding n IDs from the generator. IDs are
+// generated lazily, so breaking out of the loop stops generation.
+func (f *Flake) Iter(n int) iter.Seq[ID] {
+	return func(yield func(ID) bool) {
+		for i := 0; i < n; i++ {
+			if !yield(f.NextID()) {
+				return
+			}
+		}
+	}
+}
+
+// FillIDs fills dst with new IDs from the generator, in increasing order. It
+// locks the generator once for the whole batch and does not allocate, so a
+// slice can be reused across batches. The rate limit counts the batch as
+// len(dst) IDs. Like NextID, it waits for small corrections of the clock,
+// keeps going when the clock is stuck or moved backwards beyond the tolerance,
+// and ignores write errors of the replay log; use NextIDContext to see them.
+func (f *Flake) FillIDs(dst []ID) {
+	ctx := context.Background()
+	f.prepare(ctx, len(dst))
+
+	step := uint64(f.resolution / f.unit)
+	s := f.shard()
+	high := f.high(0)
+	now, _ := f.lockClock(ctx, s, false)
+	defer f.unlock(s)
+	for i := range dst {
+		if i > 0 {
+			now = f.getTimestamp()
+		}
+		if f.catchUp {
+			now, _ = f.catchUpClock(ctx, s, now, step, 1, false)
+		}
+		timestamp, sequence := f.advance(s, now, step)
+		if f.descending {
+			timestamp = f.layout.maxTimestamp() - timestamp
+		}
+		// Load the worker id for every ID, as waiting for the clock lets
+		// WithIDRefresh switch it.
+		dst[i] = f.layout.pack(timestamp, 0, f.workerID.Load(), sequence|high)
+		if f.replay != nil {
+			f.logID(dst[i])
+		}
+	}
+}
+
+// Tag returns the tag packed into id by NextIDTagged
+func (f *Flake) Tag(id ID) uint64 {
+	return f.layout.tag(id)
+}
+
+// ownWorker tells next to use the generator's worker id.
+const ownWorker = math.MaxUint64
+
+// next generates an ID carrying tag, workerID and priority. A strict call
+// returns ErrClockBackwards instead of reusing the last timestamp when the
+// clock moved backwards beyond the tolerance.
+func (f *Flake) next(ctx context.Context, tag, workerID, priority uint64, strict bool) (ID, error) {
+	if err := f.prepare(ctx, 1); err != nil {
+		return 0, err
+	}
+
+	step := uint64(f.resolution / f.unit)
+	s := f.shard()
+	now, err := f.lockClock(ctx, s, strict)
+	if err != nil {
+		return 0, err
+	}
+	if f.catchUp {
+		if now, err = f.catchUpClock(ctx, s, now, step, 1, strict); err != nil {
+			return 0, err
+		}
+	}
+	now, sequence := f.advance(s, now, step)
+
+	if f.descending {
+		now = f.layout.maxTimestamp() - now
+	}
+	if workerID == ownWorker {
+		workerID = f.workerID.Load()
+	}
+	id := f.layout.pack(now, tag, workerID, sequence|f.high(priority))
+
+	// Log the ID before handing it out, holding the shard lock so the log
+	// keeps the order of the shard's IDs.
+	if f.replay != nil {
+		if err := f.logID(id); err != nil && strict {
+			f.unlock(s)
+			return 0, err
+		}
+	}
+	f.unlock(s)
+	return id, nil
+}
+
+// prepare runs the checks that come before generating n IDs, and waits for
+// the rate limit to allow them.
+func (f *Flake) prepare(ctx context.Context, n int) error {
+	if f.getpid != nil {
+		f.checkFork()
+	}
+	if f.refresh != nil {
+		f.refreshWorker(false)
+	}
+	if f.limiter != nil {
+		if wait := f.limiter.reserve(f.now(), n); wait > 0 {
+			if err := f.sleep(ctx, wait); err != nil {
+				f.limiter.cancel(n)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lockClock locks the shard and returns the current timestamp, after waiting
+// for the clock to catch up if it moved backwards within the tolerance. A
+// strict call returns the clock errors of NextIDContext instead of going on
+// with the last timestamp. The shard is left unlocked on error.
+func (f *Flake) lockClock(ctx context.Context, s *shard, strict bool) (uint64, error) {
+	t := f.now()
+	if strict && t.Before(f.epoch) {
+		return 0, ErrBeforeEpoch
+	}
+	now := f.timestampAt(t)
+	f.lock(s)
+	for now < s.lastClock {
+		behind := time.Duration(s.lastClock-now) * f.unit
+		if behind > f.tolerance {
+			s.backwards++
+			if strict {
+				f.unlock(s)
+				return 0, ErrClockBackwards
+			}
+			break
+		}
+
+		// Wait for small corrections of the clock to pass.
+		f.unlock(s)
+		if err := f.sleep(ctx, behind); err != nil {
+			return 0, err
+		}
+		now = f.getTimestamp()
+		f.lock(s)
+	}
+	if f.stuckAfter > 0 {
+		// The clock is stuck if it kept returning the same time while
+		// running out of sequence numbers moved the shard on by more than
+		// the threshold. Leading a clock that advances is not.
+		if reading := t.UnixNano(); reading != s.seenClock {
+			s.seenClock, s.seenOverflows = reading, s.overflows
+		} else if strict && time.Duration((s.overflows-s.seenOverflows)*uint64(f.resolution/f.unit))*f.unit > f.stuckAfter {
+			f.unlock(s)
+			return 0, ErrClockStuck
+		}
+	}
+	return now, nil
+}
 
-	f.mu.Lock()
-	sequence := f.sequence
+// catchUpClock waits for the clock to pass the last timestamp of the locked
+// shard while fewer than n of its sequence numbers are left, so that the shard
+// does not move on ahead of the clock. It returns the current timestamp with
+// the shard locked, or an error with the shard unlocked.
+func (f *Flake) catchUpClock(ctx context.Context, s *shard, now, step, n uint64, strict bool) (uint64, error) {
+	for now <= s.prevTime && s.last-s.sequence < n {
+		next := f.epoch.Add(time.Duration(s.prevTime+step) * f.unit)
+		f.unlock(s)
+		if err := f.sleep(ctx, next.Sub(f.now())); err != nil {
+			return 0, err
+		}
+		var err error
+		if now, err = f.lockClock(ctx, s, strict); err != nil {
+			return 0, err
+		}
+	}
+	return now, nil
+}
+
+// advance moves the shard on to the timestamp and sequence number of its next
+// ID, given the current timestamp. The shard must be locked.
+func (f *Flake) advance(s *shard, now, step uint64) (uint64, uint64) {
+	if now > s.lastClock {
+		s.lastClock = now
+	}
+	if f.counter {
+		// A counter moves on to the next timestamp with every ID.
+		now = s.prevTime + step
+	}
+	sequence := s.sequence
 
 	// Use the sequence number if the id request is in the same millisecond as
 	// the previous request.
-	if now <= f.prevTime {
-		now = f.prevTime
+	if now <= s.prevTime {
+		now = s.prevTime
 		sequence++
+	} else if f.randomSeq {
+		sequence = s.first + mathrand.Uint64N((s.last-s.first)/2+1)
 	} else {
-		sequence = 0
+		sequence = s.first
+	}
+
+	// Bump the timestamp by one step if we run out of sequence bits.
+	if sequence > s.last {
+		now += step
+		sequence = s.first
+		s.overflows++
+	}
+
+	s.prevTime = now
+	s.sequence = sequence
+	s.generated++
+	if f.crash != nil {
+		f.touch(now, false)
+	}
+	return now, sequence
+}
+
+// lock locks the shard unless the generator was created with
+// WithUnsafeNoLock.
+func (f *Flake) lock(s *shard) {
+	if !f.nolock {
+		s.mu.Lock()
+	}
+}
+
+func (f *Flake) unlock(s *shard) {
+	if !f.nolock {
+		s.mu.Unlock()
+	}
+}
+
+// logID appends id to the replay log.
+func (f *Flake) logID(id ID) error {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(id))
+
+	f.replayMu.Lock()
+	defer f.replayMu.Unlock()
+	_, err := f.replay.Write(b[:])
+	return err
+}
+
+// checkFork gives the generator a new random worker id when it finds itself
+// running in a different process than the one that created it, so that forked
+// copies sharing the same state do not generate the same IDs.
+func (f *Flake) checkFork() {
+	pid := int64(f.getpid())
+	if pid == f.pid.Load() {
+		return
+	}
+
+	f.forkMu.Lock()
+	defer f.forkMu.Unlock()
+	if pid == f.pid.Load() {
+		// Another caller already reseeded the generator.
+		return
 	}
+	if workerID, err := getRandomID(); err == nil {
+		f.workerID.Store(f.layout.foldWorker(workerID))
+	}
+	f.pid.Store(pid)
+}
+
+// Warm does the work the next ID would otherwise start: it checks for a fork,
+// derives the worker id again if WithIDRefresh made that due, and writes the
+// crash marker if one is due, waiting for each to finish. Call it before a
+// latency sensitive burst, so that the first IDs of the burst do none of this.
+func (f *Flake) Warm() {
+	if f.getpid != nil {
+		f.checkFork()
+	}
+	if f.refresh != nil {
+		f.refreshWorker(true)
+	}
+	if f.crash != nil {
+		// The marker must cover the timestamps already used.
+		now := f.getTimestamp()
+		for _, s := range f.shards {
+			f.lock(s)
+			now = max(now, s.prevTime)
+			f.unlock(s)
+		}
+		f.touch(now, true)
+	}
+}
+
+// WaitUntilReady blocks until the clock appears stable, meaning two
+// consecutive reads taken readyInterval apart are after the epoch and agree
+// within readyTolerance, or until ctx is done.
+func (f *Flake) WaitUntilReady(ctx context.Context) error {
+	prev := f.now()
+	for {
+		if err := f.sleep(ctx, readyInterval); err != nil {
+			return err
+		}
+
+		cur := f.now()
+		if d := cur.Sub(prev); prev.After(f.epoch) && d >= 0 && d <= readyTolerance {
+			return nil
+		}
+		prev = cur
+	}
+}
+
+// SyncFrom advances the generator past the timestamp of lastID, typically
+// the latest ID issued by a primary generator this one stands in for, so
+// that it never reuses that timestamp.
+func (f *Flake) SyncFrom(lastID ID) {
+	timestamp := f.timestamp(lastID)
+	for _, s := range f.shards {
+		s.mu.Lock()
+		if s.prevTime <= timestamp {
+			// The next ID bumps the timestamp past lastID.
+			s.prevTime = timestamp
+			s.sequence = s.last
+		}
+		s.mu.Unlock()
+	}
+}
+
+// Time returns the creation time in UTC of an ID generated by f
+func (f *Flake) Time(id ID) time.Time {
+	return f.epoch.Add(time.Duration(f.timestamp(id)) * f.unit).UTC()
+}
+
+// timestamp returns the timestamp of id in time units since the epoch.
+func (f *Flake) timestamp(id ID) uint64 {
+	timestamp := f.layout.timestamp(id)
+	if f.descending {
+		timestamp = f.layout.maxTimestamp() - timestamp
+	}
+	return timestamp
+}
+
+// StartedAt returns the time the generator was created at
+func (f *Flake) StartedAt() time.Time {
+	return f.started
+}
+
+// LooksNative reports whether id is plausibly an ID generated with f's
+// configuration: bits outside the layout are unset and the timestamp is not
+// more than a minute in the future. It is a heuristic and cannot tell f's IDs
+// from foreign values that happen to pass these checks.
+func (f *Flake) LooksNative(id ID) bool {
+	return f.InRange(id) && !f.Time(id).After(f.now().Add(time.Minute))
+}
+
+// InRange reports whether id lies in the range of IDs f's configuration can
+// represent, from the epoch to the overflow of the timestamp bits. Unlike
+// LooksNative, it does not consider the current time.
+func (f *Flake) InRange(id ID) bool {
+	used := f.layout.timestampShift() + f.layout.TimestampBits
+	return used >= 64 || uint64(id)>>used == 0
+}
+
+// counterMax returns the largest sequence number the generator counts to,
+// leaving out the high sequence bits taken by the salt and the priority.
+func (f *Flake) counterMax() uint64 {
+	return mask(f.layout.SequenceBits - f.saltBits - f.prioBits)
+}
 
-	// Bump the timestamp by 1ms if we run out of sequence bits.
-	if sequence > MaxSequence {
-		now++
-		sequence = 0
+// high returns the high sequence bits of an ID with the given priority: the
+// salt, followed by the priority inverted so that higher priorities sort
+// first.
+func (f *Flake) high(priority uint64) uint64 {
+	if f.prioBits == 0 {
+		return f.salt
 	}
+	return f.salt | (mask(f.prioBits)-priority)<<(f.layout.SequenceBits-f.saltBits-f.prioBits)
+}
+
+// shard picks the shard serving the next request, spreading requests evenly
+// between shards.
+func (f *Flake) shard() *shard {
+	if len(f.shards) == 1 {
+		return f.shards[0]
+	}
+	return f.shards[f.nextShard.Add(1)%uint64(len(f.shards))]
+}
+
+// LifetimeRemaining returns how long the generator can run before its
+// timestamp bits overflow
+func (f *Flake) LifetimeRemaining() time.Duration {
+	max := f.layout.maxTimestamp()
+	if max >= uint64(math.MaxInt64/int64(f.unit)) {
+		return math.MaxInt64
+	}
+	end := f.epoch.Add(time.Duration(max+1) * f.unit)
+	if left := end.Sub(f.now()); left > 0 {
+		return left
+	}
+	return 0
+}
 
-	f.prevTime = now
-	f.sequence = sequence
-	f.mu.Unlock()
+// getTimestamp returns the timestamp in time units adjusted for the custom
+// epoch and truncated to the time resolution
+func (f *Flake) getTimestamp() uint64 {
+	return f.timestampAt(f.now())
+}
 
-	timestamp := now << (HostBits + SequenceBits)
-	workerID := f.workerID << SequenceBits
-	return ID(timestamp | workerID | sequence)
+// timestampAt returns the timestamp of t like getTimestamp. Times before the
+// epoch return zero rather than wrapping around.
+func (f *Flake) timestampAt(t time.Time) uint64 {
+	elapsed := t.Sub(f.epoch)
+	if elapsed < 0 {
+		return 0
+	}
+	timestamp := uint64(elapsed / f.unit)
+	return timestamp - timestamp%uint64(f.resolution/f.unit)
 }
 
-// getTimestamp returns the timestamp in milliseconds adjusted for the custom
-// epoch
-func getTimestamp() uint64 {
-	return uint64(time.Since(Epoch).Nanoseconds() / 1e6)
+// sleep pauses for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
 }
 
-// getHostID returns the host id using the IP address of the machine
+// hostname, lookupIP and interfaceAddrs are replaced in tests.
+var (
+	hostname       = os.Hostname
+	lookupIP       = net.LookupIP
+	interfaceAddrs = net.InterfaceAddrs
+)
+
+// getHostID returns the host id using the IP address of the machine. The
+// address is found by resolving the hostname, or failing that, among the
+// addresses of the network interfaces.
 func getHostID() (uint64, error) {
-	h, err := os.Hostname()
+	ip, err := resolveHostIP()
 	if err != nil {
-		return 0, err
+		var ifaceErr error
+		if ip, ifaceErr = interfaceIP(); ifaceErr != nil {
+			return 0, errors.Join(err, ifaceErr)
+		}
 	}
+	return uint64(binary.BigEndian.Uint32(ip)), nil
+}
 
-	addrs, err := net.LookupIP(h)
+// resolveHostIP returns the IPv4 address the hostname resolves to.
+func resolveHostIP() (net.IP, error) {
+	h, err := hostname()
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+
+	addrs, err := lookupIP(h)
+	if err != nil {
+		return nil, err
 	}
 
 	a := addrs[0].To4()
 	if len(a) < 4 {
-		return 0, errors.New("failed to resolve hostname")
+		return nil, errors.New("failed to resolve hostname")
 	}
+	return a, nil
+}
 
-	ip := binary.BigEndian.Uint32(a)
-	return uint64(ip), nil
+// interfaceIP returns the first IPv4 address of a network interface that is
+// not a loopback address.
+func interfaceIP() (net.IP, error) {
+	addrs, err := interfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
+			if a := ipnet.IP.To4(); a != nil {
+				return a, nil
+			}
+		}
+	}
+	return nil, errors.New("no network interface has an IPv4 address")
 }
 
 // getRandomID generates random worker id
@@ -1,8 +1,19 @@
 package flake
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
 	"sort"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestNewFlake(t *testing.T) {
@@ -21,6 +32,1111 @@ func TestNewFlake(t *testing.T) {
 	}
 }
 
+func TestNewCounter(t *testing.T) {
+	f := NewCounter(3)
+	for i := uint64(1); i <= 1000; i++ {
+		if got, want := f.NextID(), DefaultLayout.pack(i, 0, 3, 0); got != want {
+			t.Fatalf("ID %d = %d, want %d", i, got, want)
+		}
+		// Reading the clock does not advance the counter.
+		f.LooksNative(0)
+		f.Drift()
+	}
+}
+
+func TestNextIDTagged(t *testing.T) {
+	layout := Layout{TimestampBits: 41, TagBits: 3, WorkerBits: 7, SequenceBits: 13}
+	f, err := NewWithOptions(5, WithLayout(layout))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tag := range []uint64{0, 1, 4, 7} {
+		id, err := f.NextIDTagged(tag)
+		if err != nil {
+			t.Fatalf("tag %d: %v", tag, err)
+		}
+		if got := f.Tag(id); got != tag {
+			t.Errorf("Tag() = %d, want %d", got, tag)
+		}
+		if got := layout.worker(id); got != 5 {
+			t.Errorf("worker = %d, want 5", got)
+		}
+	}
+
+	if _, err := f.NextIDTagged(8); err != ErrInvalidTag {
+		t.Errorf("NextIDTagged(8) error = %v, want ErrInvalidTag", err)
+	}
+}
+
+func TestNextIDForShard(t *testing.T) {
+	f := New(5)
+	freeze(f, time.Now())
+
+	var prev ID
+	for i, shard := range []uint64{0, 17, MaxWorkerID, 17} {
+		id, err := f.NextIDForShard(shard)
+		if err != nil {
+			t.Fatalf("shard %d: %v", shard, err)
+		}
+		if id.WorkerID() != shard {
+			t.Errorf("WorkerID() = %d, want %d", id.WorkerID(), shard)
+		}
+		if got := id.Sequence(); got != uint64(i) {
+			t.Errorf("Sequence() = %d, want %d", got, i)
+		}
+		if id == prev {
+			t.Errorf("duplicate ID %d", id)
+		}
+		prev = id
+	}
+	if got := f.NextID().WorkerID(); got != 5 {
+		t.Errorf("NextID() worker = %d, want 5", got)
+	}
+
+	if _, err := f.NextIDForShard(MaxWorkerID + 1); err != ErrInvalidShard {
+		t.Errorf("NextIDForShard(MaxWorkerID+1) error = %v, want ErrInvalidShard", err)
+	}
+}
+
+func TestNextIDPriority(t *testing.T) {
+	f, err := NewWithOptions(1, WithPriorityBits(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	freeze(f, time.Now())
+
+	low, err := f.NextIDPriority(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	high, err := f.NextIDPriority(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if high >= low {
+		t.Errorf("priority 3 ID %d does not sort before priority 0 ID %d", high, low)
+	}
+	if plain := f.NextID(); plain < low {
+		t.Errorf("NextID() %d sorts before an earlier priority 0 ID %d", plain, low)
+	}
+	if got, want := f.counterMax(), uint64(1<<11-1); got != want {
+		t.Errorf("counterMax() = %d, want %d", got, want)
+	}
+
+	if _, err := f.NextIDPriority(4); err != ErrInvalidPriority {
+		t.Errorf("NextIDPriority(4) error = %v, want ErrInvalidPriority", err)
+	}
+	if _, err := New(1).NextIDPriority(1); err != ErrInvalidPriority {
+		t.Errorf("NextIDPriority(1) without priority bits error = %v, want ErrInvalidPriority", err)
+	}
+}
+
+func TestLifetimeRemaining(t *testing.T) {
+	layout := Layout{TimestampBits: 20, WorkerBits: 10, SequenceBits: 13}
+	f, err := NewWithOptions(1, WithLayout(layout))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2^20 ms is a little over 17 minutes.
+	f.now = func() time.Time { return Epoch.Add(10 * time.Minute) }
+	want := time.Duration(1<<20)*time.Millisecond - 10*time.Minute
+	if got := f.LifetimeRemaining(); got != want {
+		t.Errorf("LifetimeRemaining() = %v, want %v", got, want)
+	}
+
+	f.now = func() time.Time { return Epoch.Add(time.Hour) }
+	if got := f.LifetimeRemaining(); got != 0 {
+		t.Errorf("LifetimeRemaining() after overflow = %v, want 0", got)
+	}
+
+	if got := New(1).LifetimeRemaining(); got < 50*365*24*time.Hour {
+		t.Errorf("default LifetimeRemaining() = %v, want decades", got)
+	}
+}
+
+// freeze pins the generator's clock to a single instant.
+func freeze(f *Flake, at time.Time) {
+	f.now = func() time.Time { return at }
+	for _, s := range f.shards {
+		s.prevTime = f.getTimestamp()
+		s.lastClock = s.prevTime
+	}
+}
+
+func TestIter(t *testing.T) {
+	f := New(1)
+	freeze(f, time.Now())
+
+	var ids []ID
+	for id := range f.Iter(10) {
+		ids = append(ids, id)
+		if len(ids) == 3 {
+			break
+		}
+	}
+	if len(ids) != 3 {
+		t.Fatalf("got %d IDs, want 3", len(ids))
+	}
+
+	// The clock is frozen, so the sequence counts every ID generated.
+	first := DefaultLayout.sequence(ids[0])
+	if got := DefaultLayout.sequence(f.NextID()); got != first+3 {
+		t.Errorf("sequence after break = %d, want %d", got, first+3)
+	}
+}
+
+func TestSequenceShardsUnique(t *testing.T) {
+	f, err := NewWithOptions(1, WithSequenceShards(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const goroutines, perGoroutine = 8, 5000
+	results := make(chan []ID, goroutines)
+	for g := 0; g < goroutines; g++ {
+		go func() {
+			ids := make([]ID, perGoroutine)
+			for i := range ids {
+				ids[i] = f.NextID()
+			}
+			results <- ids
+		}()
+	}
+
+	seen := make(map[ID]bool, goroutines*perGoroutine)
+	for g := 0; g < goroutines; g++ {
+		for _, id := range <-results {
+			if seen[id] {
+				t.Fatalf("duplicate ID %d", id)
+			}
+			seen[id] = true
+		}
+	}
+
+	if _, err := NewWithOptions(1, WithSequenceShards(0)); err == nil {
+		t.Error("expected an error for zero shards")
+	}
+}
+
+func TestDescending(t *testing.T) {
+	f, err := NewWithOptions(1, WithDescending())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 6, 1, 13, 4, 5, 0, time.UTC)
+	freeze(f, start)
+	first := f.NextID()
+	freeze(f, start.Add(time.Second))
+	second := f.NextID()
+
+	if second >= first {
+		t.Errorf("later ID %d is not smaller than earlier ID %d", second, first)
+	}
+	if got := f.Time(first); !got.Equal(start) {
+		t.Errorf("Time(first) = %v, want %v", got, start)
+	}
+	if got := f.Time(second); !got.Equal(start.Add(time.Second)) {
+		t.Errorf("Time(second) = %v, want %v", got, start.Add(time.Second))
+	}
+}
+
+func TestWaitUntilReady(t *testing.T) {
+	f := New(1)
+
+	// The clock jumps forward by an hour on the second read and advances
+	// normally afterwards.
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	reads := 0
+	f.now = func() time.Time {
+		reads++
+		if reads == 1 {
+			return start
+		}
+		return start.Add(time.Hour + time.Duration(reads)*readyInterval)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := f.WaitUntilReady(ctx); err != nil {
+		t.Fatalf("WaitUntilReady() = %v", err)
+	}
+	if reads != 3 {
+		t.Errorf("clock read %d times, want 3", reads)
+	}
+}
+
+func TestNextIDAtSecondBoundary(t *testing.T) {
+	f := New(1)
+	now := time.Date(2024, 6, 1, 12, 0, 0, 300e6, time.UTC)
+	freeze(f, now)
+	f.now = func() time.Time { return now }
+	f.sleep = func(ctx context.Context, d time.Duration) error {
+		now = now.Add(d)
+		return ctx.Err()
+	}
+
+	id, err := f.NextIDAtSecondBoundary(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2024, 6, 1, 12, 0, 1, 0, time.UTC); !id.Time().Equal(want) {
+		t.Errorf("Time() = %v, want %v", id.Time(), want)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := f.NextIDAtSecondBoundary(ctx); err != context.Canceled {
+		t.Errorf("NextIDAtSecondBoundary() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestWaitUntilReadyCanceled(t *testing.T) {
+	f := New(1)
+
+	// A clock that keeps jumping never becomes ready.
+	jump := time.Now()
+	f.now = func() time.Time {
+		jump = jump.Add(time.Hour)
+		return jump
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*readyInterval)
+	defer cancel()
+	if err := f.WaitUntilReady(ctx); err != context.DeadlineExceeded {
+		t.Errorf("WaitUntilReady() = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestForkDetection(t *testing.T) {
+	f, err := NewWithOptions(1, WithForkDetection())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pid := 100
+	f.getpid = func() int { return pid }
+	f.pid.Store(int64(pid))
+	if got := f.NextID().WorkerID(); got != 1 {
+		t.Fatalf("worker before fork = %d, want 1", got)
+	}
+
+	// Simulate running in a forked child. The chance of drawing worker id 1
+	// again is 1 in 1024, so retry a few times to keep the test reliable.
+	for i := 0; i < 5; i++ {
+		pid++
+		if f.NextID().WorkerID() != 1 {
+			return
+		}
+	}
+	t.Error("worker id was not reseeded after the process id changed")
+}
+
+func TestForkDetectionUnlocked(t *testing.T) {
+	f, err := NewWithOptions(1, WithForkDetection())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// While the process id is unchanged, the fork check does not lock.
+	f.forkMu.Lock()
+	defer f.forkMu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		f.NextID()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("NextID waited for the fork lock")
+	}
+}
+
+func TestSameWorker(t *testing.T) {
+	f := New(1)
+	a, b := f.NextID(), f.NextID()
+	if !a.SameWorker(b) {
+		t.Errorf("IDs %d and %d from one generator are not from the same worker", a, b)
+	}
+
+	c := New(2).NextID()
+	if a.SameWorker(c) {
+		t.Errorf("IDs %d and %d from workers 1 and 2 are from the same worker", a, c)
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	at := time.Now()
+	f, g := New(1), New(2)
+	freeze(f, at)
+	freeze(g, at)
+	a, b := f.NextID(), g.NextID()
+	if !a.Concurrent(b) {
+		t.Errorf("IDs %d and %d from workers 1 and 2 in one millisecond are not concurrent", a, b)
+	}
+	if next := f.NextID(); a.Concurrent(next) {
+		t.Errorf("IDs %d and %d from one worker are concurrent", a, next)
+	}
+
+	freeze(g, at.Add(time.Millisecond))
+	if c := g.NextID(); a.Concurrent(c) {
+		t.Errorf("IDs %d and %d from different milliseconds are concurrent", a, c)
+	}
+}
+
+func TestLogicalClock(t *testing.T) {
+	f := New(MaxWorkerID)
+	at := time.Now()
+	freeze(f, at)
+
+	prev := f.NextID().LogicalClock()
+	for i := 0; i < 20000; i++ {
+		if i == 10000 {
+			freeze(f, at.Add(time.Second))
+		}
+		cur := f.NextID().LogicalClock()
+		if cur <= prev {
+			t.Fatalf("LogicalClock() = %d after %d", cur, prev)
+		}
+		prev = cur
+	}
+
+	if got, want := DefaultLayout.pack(3, 0, 7, 5).LogicalClock(), 3*(MaxSequence+1)+5; got != want {
+		t.Errorf("LogicalClock() = %d, want %d", got, want)
+	}
+}
+
+func TestWorkerHighBits(t *testing.T) {
+	// A 3-bit rack followed by a 7-bit machine number.
+	const rack, machine = 5, 42
+	id := New(rack<<7 | machine).NextID()
+
+	if got := id.WorkerHighBits(3); got != rack {
+		t.Errorf("WorkerHighBits(3) = %d, want %d", got, rack)
+	}
+	if got := id.WorkerHighBits(0); got != 0 {
+		t.Errorf("WorkerHighBits(0) = %d, want 0", got)
+	}
+	if got := id.WorkerHighBits(HostBits); got != id.WorkerID() {
+		t.Errorf("WorkerHighBits(HostBits) = %d, want %d", got, id.WorkerID())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("WorkerHighBits(HostBits+1) did not panic")
+		}
+	}()
+	id.WorkerHighBits(HostBits + 1)
+}
+
+func TestOrdinal(t *testing.T) {
+	f := New(1)
+	freeze(f, time.Now())
+	for want := uint64(0); want < 3; want++ {
+		id := f.NextID()
+		if id.Ordinal() != id.Sequence() {
+			t.Errorf("Ordinal() = %d, Sequence() = %d", id.Ordinal(), id.Sequence())
+		}
+		if id.Ordinal() != want {
+			t.Errorf("Ordinal() = %d, want %d", id.Ordinal(), want)
+		}
+	}
+}
+
+func TestInt64(t *testing.T) {
+	for _, id := range []ID{0, 1, math.MaxInt64 - 1, math.MaxInt64} {
+		v, err := id.Int64()
+		if err != nil {
+			t.Fatalf("Int64() of %d: %v", id, err)
+		}
+		got, err := FromInt64(v)
+		if err != nil || got != id {
+			t.Errorf("FromInt64(%d) = %d, %v, want %d", v, got, err, id)
+		}
+	}
+	if _, err := FromInt64(-1); err == nil {
+		t.Error("FromInt64(-1) did not fail")
+	}
+	if _, err := FromInt64(math.MinInt64); err == nil {
+		t.Error("FromInt64(MinInt64) did not fail")
+	}
+
+	if _, err := ID(math.MaxInt64 + 1).Int64(); err == nil {
+		t.Error("Int64() did not fail with the top bit set")
+	}
+}
+
+func TestExpiredAfter(t *testing.T) {
+	if old := FirstIDAt(time.Now().Add(-time.Hour)); !old.ExpiredAfter(time.Minute) {
+		t.Error("ID from an hour ago is not expired after a minute")
+	}
+	if fresh := New(1).NextID(); fresh.ExpiredAfter(time.Minute) {
+		t.Error("fresh ID is expired after a minute")
+	}
+	if future := FirstIDAt(time.Now().Add(time.Hour)); future.ExpiredAfter(0) {
+		t.Error("ID from the future is expired")
+	}
+}
+
+func TestTimeResolution(t *testing.T) {
+	f, err := NewWithOptions(1, WithTimeResolution(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := time.Date(2024, 6, 1, 13, 4, 5, 123e6, time.UTC)
+	freeze(f, at)
+	a, b := f.NextID(), f.NextID()
+
+	want := at.Truncate(time.Minute)
+	if got := a.Time(); !got.Equal(want) {
+		t.Errorf("Time() = %v, want %v", got, want)
+	}
+	if b <= a {
+		t.Errorf("IDs within one interval are not increasing: %d, %d", a, b)
+	}
+
+	for _, d := range []time.Duration{0, time.Microsecond, 1500 * time.Microsecond} {
+		if _, err := NewWithOptions(1, WithTimeResolution(d)); err == nil {
+			t.Errorf("WithTimeResolution(%v) expected an error", d)
+		}
+	}
+}
+
+func TestNanosecondSingleWorker(t *testing.T) {
+	f, err := NewWithOptions(1, WithNanosecondSingleWorker())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := time.Date(2024, 6, 1, 13, 4, 5, 123456789, time.UTC)
+	freeze(f, at)
+	a, b := f.NextID(), f.NextID()
+
+	ta, tb := f.layout.timestamp(a), f.layout.timestamp(b)
+	if tb <= ta {
+		t.Errorf("timestamps %d and %d are not increasing", ta, tb)
+	}
+
+	freeze(f, at)
+	f.now = func() time.Time { return at.Add(time.Microsecond) }
+	if got := f.Time(f.NextID()); !got.Equal(at.Add(time.Microsecond)) {
+		t.Errorf("Time() = %v, want %v", got, at.Add(time.Microsecond))
+	}
+}
+
+func TestWarm(t *testing.T) {
+	stubHost(t,
+		func() (string, error) { return "api-7", nil },
+		func(string) ([]net.IP, error) { return []net.IP{net.IPv4(10, 0, 2, 9)}, nil })
+	path := filepath.Join(t.TempDir(), "marker")
+	f, err := NewWithOptions(7, WithIDRefresh(time.Minute), WithCrashSafety(path, time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Now().Add(2 * time.Minute)
+	freeze(f, at)
+
+	// Warm derives the worker id and writes the marker before returning.
+	f.Warm()
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("no crash marker after Warm: %v", err)
+	}
+	id := f.NextID()
+	if got, want := id.WorkerID(), uint64(2<<8|9); got != want {
+		t.Errorf("worker after Warm = %d, want %d", got, want)
+	}
+	if f.refresh.running.Load() || f.crash.writing.Load() {
+		t.Error("the first ID after Warm started background work")
+	}
+}
+
+// sequenceEntropy returns the Shannon entropy in bits of the sequence
+// components of ids.
+func sequenceEntropy(ids []ID) float64 {
+	count := make(map[uint64]int)
+	for _, id := range ids {
+		count[DefaultLayout.sequence(id)]++
+	}
+
+	var entropy float64
+	for _, n := range count {
+		p := float64(n) / float64(len(ids))
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+func TestRandomSequenceEntropy(t *testing.T) {
+	// Generate every ID in a fresh millisecond.
+	generate := func(f *Flake) []ID {
+		at := time.Now()
+		f.now = func() time.Time {
+			at = at.Add(time.Millisecond)
+			return at
+		}
+		ids := make([]ID, 1000)
+		for i := range ids {
+			ids[i] = f.NextID()
+		}
+		return ids
+	}
+
+	if e := sequenceEntropy(generate(New(1))); e > 1 {
+		t.Errorf("default sequence entropy = %.2f bits, want close to 0", e)
+	}
+
+	f, err := NewWithOptions(1, WithRandomSequence())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := sequenceEntropy(generate(f)); e < 9 {
+		t.Errorf("random sequence entropy = %.2f bits, want close to 10", e)
+	}
+}
+
+func TestLooksNative(t *testing.T) {
+	f := New(1)
+	if id := f.NextID(); !f.LooksNative(id) {
+		t.Errorf("LooksNative(%d) = false for a generated ID", id)
+	}
+	if id := ID(math.MaxUint64 - 12345); f.LooksNative(id) {
+		t.Errorf("LooksNative(%d) = true for a foreign value", id)
+	}
+
+	small, err := NewWithOptions(1, WithLayout(Layout{TimestampBits: 41, WorkerBits: 8, SequenceBits: 12}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := ID(1 << 62); small.LooksNative(id) {
+		t.Errorf("LooksNative(%d) = true with bits outside the layout", id)
+	}
+}
+
+func TestInRange(t *testing.T) {
+	l := Layout{TimestampBits: 40, WorkerBits: 10, SequenceBits: 13}
+	f, err := NewWithOptions(1, WithLayout(l))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id := l.pack(0, 0, 0, 0); !f.InRange(id) {
+		t.Errorf("InRange(%d) = false at the epoch", id)
+	}
+	last := l.pack(l.maxTimestamp(), 0, l.maxWorker(), l.maxSequence())
+	if !f.InRange(last) {
+		t.Errorf("InRange(%d) = false for the last timestamp", last)
+	}
+	if f.InRange(last + 1) {
+		t.Errorf("InRange(%d) = true past the overflow", last+1)
+	}
+	if !New(1).InRange(math.MaxUint64) {
+		t.Error("InRange(MaxUint64) = false with all 64 bits in use")
+	}
+}
+
+func TestFillIDs(t *testing.T) {
+	f := New(1)
+	seen := make(map[ID]bool)
+	var prev ID
+	dst := make([]ID, 10000)
+	for batch := 0; batch < 2; batch++ {
+		f.FillIDs(dst)
+		for _, id := range dst {
+			if id <= prev || seen[id] {
+				t.Fatalf("ID %d is not after %d", id, prev)
+			}
+			seen[id] = true
+			prev = id
+		}
+	}
+
+	if allocs := testing.AllocsPerRun(100, func() { f.FillIDs(dst[:100]) }); allocs != 0 {
+		t.Errorf("FillIDs allocates %v times per call, want 0", allocs)
+	}
+
+	// A clock that moved backwards is counted like for NextID.
+	at := time.Now()
+	freeze(f, at)
+	f.now = func() time.Time { return at.Add(-time.Second) }
+	f.FillIDs(dst[:10])
+	if got := f.Stats().ClockBackwards; got != 1 {
+		t.Errorf("Stats().ClockBackwards = %d, want 1", got)
+	}
+}
+
+func TestNextIDAllocs(t *testing.T) {
+	f := New(1)
+	if allocs := testing.AllocsPerRun(1000, func() { f.NextID() }); allocs != 0 {
+		t.Errorf("NextID allocates %v times per call, want 0", allocs)
+	}
+}
+
+func TestCatchUpAfterBurst(t *testing.T) {
+	at := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	f := New(1)
+	freeze(f, at)
+
+	// Exhaust the sequence of three milliseconds, so that the next ID is
+	// three milliseconds ahead of the clock.
+	for i := uint64(0); i < 3*(MaxSequence+1); i++ {
+		f.NextID()
+	}
+
+	// While the clock is behind, IDs keep the timestamp the burst reached.
+	f.now = func() time.Time { return at.Add(time.Millisecond) }
+	if got, want := f.NextID().Time(), at.Add(3*time.Millisecond); !got.Equal(want) {
+		t.Errorf("Time() = %v while catching up, want %v", got, want)
+	}
+
+	f.now = func() time.Time { return at.Add(5 * time.Millisecond) }
+	id := f.NextID()
+	if got, want := id.Time(), at.Add(5*time.Millisecond); !got.Equal(want) {
+		t.Errorf("Time() = %v after idling, want %v", got, want)
+	}
+	if id.Sequence() != 0 {
+		t.Errorf("Sequence() = %d after idling, want 0", id.Sequence())
+	}
+}
+
+func TestStuckClockDetection(t *testing.T) {
+	f, err := NewWithOptions(1, WithStuckClockDetection(2*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	freeze(f, time.Now())
+
+	// Three milliseconds of sequence numbers take the generator two
+	// milliseconds ahead of the frozen clock, which is within the threshold.
+	for i := uint64(0); i < 3*(MaxSequence+1); i++ {
+		if _, err := f.NextIDContext(context.Background()); err != nil {
+			t.Fatalf("ID %d: %v", i, err)
+		}
+	}
+	for i := uint64(0); i < MaxSequence+1; i++ {
+		f.NextID()
+	}
+	if _, err := f.NextIDContext(context.Background()); err != ErrClockStuck {
+		t.Errorf("NextIDContext() error = %v, want ErrClockStuck", err)
+	}
+	if id := f.NextID(); id == 0 {
+		t.Error("NextID() gave up on a stuck clock")
+	}
+}
+
+func TestStuckClockDetectionTicking(t *testing.T) {
+	f, err := NewWithOptions(1, WithStuckClockDetection(2*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Now()
+	freeze(f, at)
+	clock := at
+	f.now = func() time.Time { return clock }
+
+	// The generator leads the clock by far more than the threshold, after
+	// SyncFrom and a large batch, while the clock keeps ticking.
+	f.SyncFrom(FirstIDAt(at.Add(time.Hour)))
+	f.FillIDs(make([]ID, 10*(MaxSequence+1)))
+	for i := uint64(0); i < 5*(MaxSequence+1); i++ {
+		if i%1000 == 0 {
+			clock = clock.Add(time.Millisecond / 10)
+		}
+		if _, err := f.NextIDContext(context.Background()); err != nil {
+			t.Fatalf("ID %d: %v", i, err)
+		}
+	}
+}
+
+func TestWithCatchUp(t *testing.T) {
+	at := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	f, err := NewWithOptions(1, WithCatchUp())
+	if err != nil {
+		t.Fatal(err)
+	}
+	freeze(f, at)
+	clock := at
+	f.now = func() time.Time { return clock }
+	f.sleep = func(_ context.Context, d time.Duration) error {
+		clock = clock.Add(d)
+		return nil
+	}
+
+	// A burst waits for the clock rather than moving on ahead of it.
+	for i := uint64(0); i <= MaxSequence; i++ {
+		f.NextID()
+	}
+	if id := f.NextID(); !id.Time().Equal(clock) || !clock.Equal(at.Add(time.Millisecond)) || id.Sequence() != 0 {
+		t.Errorf("ID after the burst has time %v and sequence %d, want %v and 0", id.Time(), id.Sequence(), clock)
+	}
+
+	// A generator put ahead of the clock converges back to it, and does
+	// not move further ahead under load.
+	lead := clock.Add(5 * time.Millisecond)
+	f.SyncFrom(FirstIDAt(lead))
+	for i := 0; i < 3*int(MaxSequence+1); i++ {
+		id := f.NextID()
+		if id.Time().After(lead.Add(time.Millisecond)) && id.Time().After(clock) {
+			t.Fatalf("ID %d at %v is ahead of the clock at %v", i, id.Time(), clock)
+		}
+		if i%100 == 0 {
+			clock = clock.Add(time.Millisecond / 10)
+		}
+	}
+	if id := f.NextID(); !id.Time().Equal(clock.Truncate(time.Millisecond)) || f.Drift() != 0 {
+		t.Errorf("ID at %v with drift %v after catching up, want %v and 0", id.Time(), f.Drift(), clock)
+	}
+
+	// FillIDs and Reserve wait for the clock too.
+	dst := make([]ID, 3*(MaxSequence+1))
+	f.FillIDs(dst)
+	if last := dst[len(dst)-1]; !last.Time().Equal(clock.Truncate(time.Millisecond)) {
+		t.Errorf("last ID of FillIDs at %v, want the clock at %v", last.Time(), clock)
+	}
+	f.FillIDs(dst[:MaxSequence+1])
+	if first, _ := f.Reserve(10); !first.Time().Equal(clock.Truncate(time.Millisecond)) {
+		t.Errorf("Reserve() at %v, want the clock at %v", first.Time(), clock)
+	}
+	if got := f.Stats().Overflows; got != 0 {
+		t.Errorf("Stats().Overflows = %d, want 0", got)
+	}
+}
+
+// scriptClock returns a clock that returns the given times in order and then
+// keeps returning the last one.
+func scriptClock(times ...time.Time) func() time.Time {
+	var mu sync.Mutex
+	return func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		t := times[0]
+		if len(times) > 1 {
+			times = times[1:]
+		}
+		return t
+	}
+}
+
+func TestClockBackwardTolerance(t *testing.T) {
+	f, err := NewWithOptions(1, WithClockBackwardTolerance(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now().Truncate(time.Millisecond)
+	freeze(f, start)
+	f.NextID()
+
+	// The clock steps back by 2ms and recovers after two reads.
+	f.now = scriptClock(start.Add(-2*time.Millisecond), start.Add(-time.Millisecond), start.Add(time.Millisecond))
+	id, err := f.NextIDContext(context.Background())
+	if err != nil {
+		t.Fatalf("NextIDContext() = %v", err)
+	}
+	if got, want := f.Time(id), start.Add(time.Millisecond); !got.Equal(want) {
+		t.Errorf("Time() = %v, want %v", got, want)
+	}
+}
+
+func TestClockBackwardBeyondTolerance(t *testing.T) {
+	f, err := NewWithOptions(1, WithClockBackwardTolerance(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now().Truncate(time.Millisecond)
+	freeze(f, start)
+	first := f.NextID()
+
+	f.now = func() time.Time { return start.Add(-time.Second) }
+	if _, err := f.NextIDContext(context.Background()); err != ErrClockBackwards {
+		t.Errorf("NextIDContext() error = %v, want ErrClockBackwards", err)
+	}
+	if id := f.NextID(); id <= first || !f.Time(id).Equal(start) {
+		t.Errorf("NextID() = %d at %v, want an ID after %d at %v", id, f.Time(id), first, start)
+	}
+}
+
+func TestNextPrev(t *testing.T) {
+	id := New(1).NextID()
+	if id.Next().Prev() != id || id.Prev().Next() != id {
+		t.Errorf("Next and Prev of %d do not round trip", id)
+	}
+	if id.Next() != id+1 {
+		t.Errorf("Next() = %d, want %d", id.Next(), id+1)
+	}
+	if got := ID(0).Prev(); got != 0 {
+		t.Errorf("ID(0).Prev() = %d, want 0", got)
+	}
+	if got := ID(math.MaxUint64).Next(); got != math.MaxUint64 {
+		t.Errorf("ID(max).Next() = %d, want max", got)
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	f := New(1)
+	at := time.Now()
+	freeze(f, at)
+	a, b, c := f.NextID(), f.NextID(), f.NextID()
+	if a.Prefix() != b.Prefix() || b.Prefix() != c.Prefix() {
+		t.Errorf("IDs in one millisecond have different prefixes: %d, %d, %d", a.Prefix(), b.Prefix(), c.Prefix())
+	}
+	if DefaultLayout.sequence(a.Prefix()) != 0 {
+		t.Errorf("Prefix() = %d has sequence bits set", a.Prefix())
+	}
+
+	freeze(f, at.Add(time.Millisecond))
+	if d := f.NextID(); d.Prefix() == a.Prefix() {
+		t.Errorf("IDs in different milliseconds share prefix %d", d.Prefix())
+	}
+}
+
+func TestSyncFrom(t *testing.T) {
+	primary, standby := New(1), New(2)
+	at := time.Now()
+	freeze(standby, at)
+
+	// The primary's clock runs a minute ahead of the standby's.
+	freeze(primary, at.Add(time.Minute))
+	lastID := primary.NextID()
+
+	standby.SyncFrom(lastID)
+	next := standby.NextID()
+	if next <= lastID {
+		t.Errorf("standby ID %d is not greater than primary ID %d", next, lastID)
+	}
+	if !next.Time().After(lastID.Time()) {
+		t.Errorf("standby reused timestamp %v", lastID.Time())
+	}
+}
+
+func TestReplayLog(t *testing.T) {
+	var log bytes.Buffer
+	f, err := NewWithOptions(1, WithReplayLog(&log))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []ID
+	for i := 0; i < 5; i++ {
+		id, err := f.NextIDContext(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	if log.Len() != 8*len(ids) {
+		t.Fatalf("log has %d bytes, want %d", log.Len(), 8*len(ids))
+	}
+	for i, want := range ids {
+		if got := ID(binary.BigEndian.Uint64(log.Next(8))); got != want {
+			t.Errorf("log entry %d = %d, want %d", i, got, want)
+		}
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestReplayLogError(t *testing.T) {
+	f, err := NewWithOptions(1, WithReplayLog(failingWriter{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.NextIDContext(context.Background()); err == nil {
+		t.Error("NextIDContext() did not return the write error")
+	}
+	if id := f.NextID(); id == 0 {
+		t.Error("NextID() did not return an ID")
+	}
+}
+
+func TestStartedAt(t *testing.T) {
+	before := time.Now()
+	f := New(1)
+	after := time.Now()
+
+	if got := f.StartedAt(); got.Before(before) || got.After(after) {
+		t.Errorf("StartedAt() = %v, want between %v and %v", got, before, after)
+	}
+}
+
+func TestReserve(t *testing.T) {
+	f := New(1)
+	freeze(f, time.Now())
+	before := f.NextID()
+
+	first, last := f.Reserve(100)
+	if last-first != 99 {
+		t.Fatalf("Reserve(100) = %d..%d, want 100 IDs", first, last)
+	}
+	if first <= before {
+		t.Errorf("reserved ID %d is not after %d", first, before)
+	}
+	for i := 0; i < 10000; i++ {
+		if id := f.NextID(); id >= first && id <= last {
+			t.Fatalf("NextID() = %d is in the reserved block %d..%d", id, first, last)
+		}
+	}
+
+	// A block that does not fit the current millisecond starts the next.
+	first, last = f.Reserve(int(MaxSequence))
+	if last-first != ID(MaxSequence)-1 || DefaultLayout.sequence(first) != 0 {
+		t.Errorf("Reserve(%d) = %d..%d", MaxSequence, first, last)
+	}
+}
+
+func TestReserveReplayLog(t *testing.T) {
+	var log bytes.Buffer
+	f, err := NewWithOptions(1, WithReplayLog(&log))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, last := f.Reserve(100)
+	if log.Len() != 8 {
+		t.Fatalf("log has %d bytes, want 8", log.Len())
+	}
+	logged := ID(binary.BigEndian.Uint64(log.Bytes()))
+	if logged != last {
+		t.Errorf("log entry = %d, want the last reserved ID %d", logged, last)
+	}
+
+	// A generator restarted from the log does not hand out the block again.
+	g := New(1)
+	freeze(g, f.Time(last))
+	g.SyncFrom(logged)
+	if id := g.NextID(); id <= last {
+		t.Errorf("NextID() = %d after restarting, want after %d", id, last)
+	}
+}
+
+func TestEpochIsNow(t *testing.T) {
+	now := time.Now()
+	f, err := NewWithOptions(1, WithEpoch(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	freeze(f, now)
+
+	a, b := f.NextID(), f.NextID()
+	if f.layout.timestamp(a) != 0 || f.layout.sequence(a) != 0 {
+		t.Errorf("first ID = %d, want timestamp and sequence 0", a)
+	}
+	if b <= a {
+		t.Errorf("IDs %d and %d are not increasing", a, b)
+	}
+}
+
+func TestBeforeEpoch(t *testing.T) {
+	epoch := time.Now().Add(time.Hour)
+	if _, err := NewWithOptions(1, WithEpoch(epoch)); !errors.Is(err, ErrBeforeEpoch) {
+		t.Errorf("NewWithOptions() error = %v, want ErrBeforeEpoch", err)
+	}
+
+	// The clock moves back before the epoch after construction.
+	f, err := NewWithOptions(1, WithEpoch(epoch.Add(-2*time.Hour)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	freeze(f, epoch.Add(-2*time.Hour))
+	f.now = func() time.Time { return epoch.Add(-3 * time.Hour) }
+	if _, err := f.NextIDContext(context.Background()); err != ErrBeforeEpoch {
+		t.Errorf("NextIDContext() error = %v, want ErrBeforeEpoch", err)
+	}
+	if ts := f.layout.timestamp(f.NextID()); ts != 0 {
+		t.Errorf("NextID() timestamp = %d, want 0 rather than a wrapped value", ts)
+	}
+}
+
+func TestUnsafeNoLock(t *testing.T) {
+	f, err := NewWithOptions(1, WithUnsafeNoLock())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prev := f.NextID()
+	for i := 0; i < 100000; i++ {
+		id := f.NextID()
+		if id <= prev {
+			t.Fatalf("ID %d is not greater than %d", id, prev)
+		}
+		prev = id
+	}
+}
+
+func TestInstanceSalt(t *testing.T) {
+	generate := func(salt uint64) []ID {
+		f, err := NewWithOptions(1, WithInstanceSalt())
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.salt = salt << (SequenceBits - 1)
+		freeze(f, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+
+		// Generate enough IDs to spill into the next millisecond.
+		ids := make([]ID, 5000)
+		seen := make(map[ID]bool)
+		for i := range ids {
+			ids[i] = f.NextID()
+			if seen[ids[i]] {
+				t.Fatalf("duplicate ID %d", ids[i])
+			}
+			seen[ids[i]] = true
+			if got := DefaultLayout.sequence(ids[i]) >> (SequenceBits - 1); got != salt {
+				t.Fatalf("salt bit of %d = %d, want %d", ids[i], got, salt)
+			}
+		}
+		return ids
+	}
+
+	a, b := generate(0), generate(1)
+	if a[0] == b[0] || a[0].Prefix() != b[0].Prefix() {
+		t.Errorf("first IDs %d and %d of different salts do not differ in their sequence only", a[0], b[0])
+	}
+}
+
+func TestStartupNonce(t *testing.T) {
+	const bits = 4
+	nonce := func(id ID) uint64 { return id.Sequence() >> (SequenceBits - bits) }
+
+	// Nonces are random, but ten generators are all but certain to draw at
+	// least two different ones.
+	byNonce := make(map[uint64]ID)
+	for i := 0; i < 10; i++ {
+		f, err := NewWithOptions(1, WithStartupNonce(bits))
+		if err != nil {
+			t.Fatal(err)
+		}
+		freeze(f, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+		first := f.NextID()
+		for j := 0; j < 100; j++ {
+			if id := f.NextID(); nonce(id) != nonce(first) {
+				t.Fatalf("nonce of %d = %d, want %d", id, nonce(id), nonce(first))
+			}
+		}
+		byNonce[nonce(first)] = first
+	}
+	if len(byNonce) < 2 {
+		t.Fatal("all generators drew the same nonce")
+	}
+	for n, id := range byNonce {
+		for m, other := range byNonce {
+			if n != m && id == other {
+				t.Errorf("generators with nonces %d and %d generated the same ID %d", n, m, id)
+			}
+		}
+	}
+
+	if _, err := NewWithOptions(1, WithStartupNonce(SequenceBits)); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("nonce of all sequence bits: error = %v, want ErrInvalidConfig", err)
+	}
+}
+
 func BenchmarkNextId(b *testing.B) {
 	f := New(1)
 
@@ -28,3 +1144,30 @@ func BenchmarkNextId(b *testing.B) {
 		_ = f.NextID()
 	}
 }
+
+func BenchmarkNextIdNoLock(b *testing.B) {
+	f, err := NewWithOptions(1, WithUnsafeNoLock())
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for i := 0; i < b.N; i++ {
+		_ = f.NextID()
+	}
+}
+
+func BenchmarkNextIdParallel(b *testing.B) {
+	for _, shards := range []int{1, 8} {
+		f, err := NewWithOptions(1, WithSequenceShards(shards))
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(strconv.Itoa(shards)+"-shards", func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					_ = f.NextID()
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package flake
+
+import "context"
+
+// IDGenerator is the interface of ID sources, for code that should not depend
+// on how its IDs are generated
+type IDGenerator interface {
+	Next() (ID, error)
+}
+
+// Generator returns f as an IDGenerator whose Next returns the errors of
+// NextIDContext. Rate-limited and NewCounter generators are adapted the same
+// way.
+func (f *Flake) Generator() IDGenerator {
+	return strictGenerator{f}
+}
+
+// LenientGenerator returns f as an IDGenerator whose Next calls NextID and
+// never fails
+func (f *Flake) LenientGenerator() IDGenerator {
+	return lenientGenerator{f}
+}
+
+type strictGenerator struct{ f *Flake }
+
+func (g strictGenerator) Next() (ID, error) {
+	return g.f.NextIDContext(context.Background())
+}
+
+type lenientGenerator struct{ f *Flake }
+
+func (g lenientGenerator) Next() (ID, error) {
+	return g.f.NextID(), nil
+}
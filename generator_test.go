@@ -0,0 +1,51 @@
+package flake
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGenerator(t *testing.T) {
+	limited, err := NewWithOptions(1, WithRateLimit(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	generators := map[string]IDGenerator{
+		"strict":       New(1).Generator(),
+		"lenient":      New(1).LenientGenerator(),
+		"rate-limited": limited.Generator(),
+		"counter":      NewCounter(1).Generator(),
+	}
+	for name, g := range generators {
+		a, err := g.Next()
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		b, err := g.Next()
+		if err != nil || b <= a {
+			t.Errorf("%s: Next() = %d, %v after %d", name, b, err, a)
+		}
+	}
+
+	g := NewCounter(3).Generator()
+	for i := uint64(1); i <= 3; i++ {
+		if id, err := g.Next(); err != nil || id != DefaultLayout.pack(i, 0, 3, 0) {
+			t.Errorf("counter Next() = %d, %v, want %d", id, err, DefaultLayout.pack(i, 0, 3, 0))
+		}
+	}
+}
+
+func TestStrictGeneratorError(t *testing.T) {
+	f := New(1)
+	freeze(f, time.Now())
+	f.now = func() time.Time { return time.Now().Add(-time.Hour) }
+
+	if _, err := f.Generator().Next(); err != ErrClockBackwards {
+		t.Errorf("strict Next() error = %v, want ErrClockBackwards", err)
+	}
+	if _, err := f.LenientGenerator().Next(); err != nil {
+		t.Errorf("lenient Next() error = %v, want nil", err)
+	}
+}
@@ -0,0 +1,35 @@
+package flake
+
+// HashShard returns the shard in [0, buckets) that id hashes to. Unlike the
+// raw ID modulo buckets, the result does not correlate with the creation time
+// of the ID. buckets must not be zero.
+func (id ID) HashShard(buckets uint32) uint32 {
+	return uint32(mix64(uint64(id)) % uint64(buckets))
+}
+
+// RingPosition returns the position of id on a consistent-hash ring spanning
+// the whole 64-bit space. Unlike the raw ID, consecutive IDs land far apart.
+func (id ID) RingPosition() uint64 {
+	return mix64(uint64(id))
+}
+
+// Child derives the ID of the index-th sub-entity of id. The same parent and
+// index always yield the same child, and different indices yield different
+// children. Children are hashes: they do not sort by time, and their
+// timestamp, worker id and sequence are meaningless.
+func (id ID) Child(index uint64) ID {
+	// The golden ratio increment of splitmix64 is odd, so every index moves
+	// the input to a different value.
+	return ID(mix64(uint64(id) + (index+1)*0x9e3779b97f4a7c15))
+}
+
+// mix64 is the finalizer of the splitmix64 generator. It spreads every input
+// bit over the whole output.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
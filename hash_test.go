@@ -0,0 +1,60 @@
+package flake
+
+import "testing"
+
+func TestHashShard(t *testing.T) {
+	const buckets, n = 8, 80000
+	f := New(1)
+
+	var counts [buckets]int
+	for i := 0; i < n; i++ {
+		shard := f.NextID().HashShard(buckets)
+		if shard >= buckets {
+			t.Fatalf("HashShard() = %d, want less than %d", shard, buckets)
+		}
+		counts[shard]++
+	}
+
+	// Expect every bucket within 5% of an even share.
+	for shard, count := range counts {
+		if count < n/buckets*95/100 || count > n/buckets*105/100 {
+			t.Errorf("bucket %d has %d IDs, want about %d", shard, count, n/buckets)
+		}
+	}
+}
+
+func TestRingPosition(t *testing.T) {
+	const arcs, n = 16, 80000
+	f := New(1)
+
+	// Split the ring into arcs by the top 4 bits of the position.
+	var counts [arcs]int
+	for i := 0; i < n; i++ {
+		counts[f.NextID().RingPosition()>>60]++
+	}
+
+	// Expect every arc within 5% of an even share.
+	for arc, count := range counts {
+		if count < n/arcs*95/100 || count > n/arcs*105/100 {
+			t.Errorf("arc %d has %d IDs, want about %d", arc, count, n/arcs)
+		}
+	}
+}
+
+func TestChild(t *testing.T) {
+	parent := New(1).NextID()
+	seen := make(map[ID]bool)
+	for i := uint64(0); i < 10000; i++ {
+		child := parent.Child(i)
+		if child != parent.Child(i) {
+			t.Fatalf("Child(%d) is not deterministic", i)
+		}
+		if child == parent || seen[child] {
+			t.Fatalf("Child(%d) = %d is not distinct", i, child)
+		}
+		seen[child] = true
+	}
+	if parent.Child(0) == parent.Next().Child(0) {
+		t.Error("children of different parents are equal")
+	}
+}
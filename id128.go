@@ -0,0 +1,129 @@
+package flake
+
+import (
+	"cmp"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ID128 represents a unique k-ordered 128-bit ID. Hi holds the nanoseconds
+// since Epoch, and Lo holds a 32-bit worker id followed by a 32-bit sequence
+// number.
+type ID128 struct {
+	Hi, Lo uint64
+}
+
+// id128Len is the length of an ID128 in Crockford base32.
+const id128Len = 26
+
+// String formats the ID as 26 characters of Crockford's base32, like a ULID.
+// Strings sort in the same order as the IDs.
+func (id ID128) String() string {
+	var b [id128Len]byte
+	hi, lo := id.Hi, id.Lo
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i] = crockfordAlphabet[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(b[:])
+}
+
+// Parse128 parses an ID128 formatted by String. Decoding is case insensitive
+// and reads I and L as 1 and O as 0.
+func Parse128(s string) (ID128, error) {
+	if len(s) != id128Len {
+		return ID128{}, fmt.Errorf("invalid 128-bit ID %q", s)
+	}
+	var id ID128
+	for i := 0; i < len(s); i++ {
+		d := crockfordDigit(s[i])
+		if d < 0 || id.Hi>>59 != 0 {
+			return ID128{}, fmt.Errorf("invalid 128-bit ID %q", s)
+		}
+		id.Hi = id.Hi<<5 | id.Lo>>59
+		id.Lo = id.Lo<<5 | uint64(d)
+	}
+	return id, nil
+}
+
+// Time returns the creation time of the ID in UTC
+func (id ID128) Time() time.Time {
+	return Epoch.Add(time.Duration(id.Hi)).UTC()
+}
+
+// WorkerID returns the worker id of the ID
+func (id ID128) WorkerID() uint32 {
+	return uint32(id.Lo >> 32)
+}
+
+// Sequence returns the sequence number of the ID
+func (id ID128) Sequence() uint32 {
+	return uint32(id.Lo)
+}
+
+// Compare returns -1 if id sorts before other, 1 if it sorts after other and
+// 0 if they are equal.
+func (id ID128) Compare(other ID128) int {
+	if c := cmp.Compare(id.Hi, other.Hi); c != 0 {
+		return c
+	}
+	return cmp.Compare(id.Lo, other.Lo)
+}
+
+// Flake128 is a unique ID128 generator
+type Flake128 struct {
+	mu       sync.Mutex
+	workerID uint32
+	prevTime uint64
+	sequence uint32
+	now      func() time.Time
+}
+
+// New128 returns a new ID128 generator
+func New128(workerID uint32) *Flake128 {
+	return &Flake128{workerID: workerID, now: time.Now}
+}
+
+// WithHostID128 creates a new ID128 generator with the host machine address
+// as worker id. The worker field holds the whole IPv4 address.
+func WithHostID128() (*Flake128, error) {
+	workerID, err := getHostID()
+	if err != nil {
+		return nil, err
+	}
+	return New128(uint32(workerID)), nil
+}
+
+// WithRandomID128 creates a new ID128 generator with a random worker id
+func WithRandomID128() (*Flake128, error) {
+	workerID, err := getRandomID()
+	if err != nil {
+		return nil, err
+	}
+	return New128(uint32(workerID)), nil
+}
+
+// NextID returns a new ID128 from the generator. If the clock moves
+// backwards, NextID keeps generating IDs from the last timestamp it used
+// until the clock catches up.
+func (f *Flake128) NextID() ID128 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := uint64(f.now().Sub(Epoch))
+	if now <= f.prevTime {
+		now = f.prevTime
+		f.sequence++
+		if f.sequence == 0 {
+			// The sequence wrapped, borrow the next nanosecond.
+			now++
+		}
+	} else {
+		f.sequence = 0
+	}
+	f.prevTime = now
+
+	return ID128{Hi: now, Lo: uint64(f.workerID)<<32 | uint64(f.sequence)}
+}
@@ -0,0 +1,93 @@
+package flake
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNew128(t *testing.T) {
+	f := New128(7)
+	prev := f.NextID()
+	for i := 0; i < 10000; i++ {
+		id := f.NextID()
+		if id.Compare(prev) <= 0 {
+			t.Fatalf("ID %v is not after %v", id, prev)
+		}
+		if id.WorkerID() != 7 {
+			t.Fatalf("worker = %d, want 7", id.WorkerID())
+		}
+		prev = id
+	}
+}
+
+func TestNew128FrozenClock(t *testing.T) {
+	at := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	f := New128(1)
+	f.now = func() time.Time { return at }
+
+	for want := uint32(0); want < 3; want++ {
+		id := f.NextID()
+		if id.Sequence() != want {
+			t.Errorf("Sequence() = %d, want %d", id.Sequence(), want)
+		}
+		if !id.Time().Equal(at) {
+			t.Errorf("Time() = %v, want %v", id.Time(), at)
+		}
+	}
+
+	// A wrapped sequence moves on to the next nanosecond.
+	f.sequence = 1<<32 - 1
+	id := f.NextID()
+	if id.Sequence() != 0 || !id.Time().Equal(at.Add(time.Nanosecond)) {
+		t.Errorf("after wrap: time %v, sequence %d", id.Time(), id.Sequence())
+	}
+}
+
+func TestID128String(t *testing.T) {
+	ids := []ID128{{}, {Hi: 1}, {Lo: 1}, {Hi: 1<<64 - 1, Lo: 1<<64 - 1}, New128(42).NextID()}
+	for _, id := range ids {
+		s := id.String()
+		if len(s) != 26 {
+			t.Errorf("String() = %q, want 26 characters", s)
+		}
+		got, err := Parse128(strings.ToLower(s))
+		if err != nil {
+			t.Errorf("Parse128(%q) error: %v", s, err)
+			continue
+		}
+		if got != id {
+			t.Errorf("Parse128(%q) = %v, want %v", s, got, id)
+		}
+	}
+
+	if got := (ID128{Hi: 1<<64 - 1, Lo: 1<<64 - 1}).String(); got != "7ZZZZZZZZZZZZZZZZZZZZZZZZZ" {
+		t.Errorf("String() of the largest ID = %q", got)
+	}
+	if a, b := (ID128{Hi: 1}).String(), (ID128{Lo: 1 << 63}).String(); a <= b {
+		t.Errorf("%q does not sort after %q", a, b)
+	}
+}
+
+func TestParse128Invalid(t *testing.T) {
+	for _, s := range []string{"", "0", "8ZZZZZZZZZZZZZZZZZZZZZZZZZ", "0000000000000000000000000U", "00000000000000000000000000a"} {
+		if _, err := Parse128(s); err == nil {
+			t.Errorf("Parse128(%q) did not fail", s)
+		}
+	}
+}
+
+func TestWithHostID128(t *testing.T) {
+	stubHost(t,
+		func() (string, error) { return "api-7", nil },
+		func(string) ([]net.IP, error) { return []net.IP{net.IPv4(10, 0, 1, 7)}, nil })
+
+	f, err := WithHostID128()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := f.NextID().WorkerID(), uint32(10<<24|1<<8|7); got != want {
+		t.Errorf("worker = %d, want %d", got, want)
+	}
+}
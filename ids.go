@@ -0,0 +1,234 @@
+package flake
+
+import (
+	"errors"
+	"math/bits"
+	"slices"
+	"time"
+)
+
+// Merge merges two slices of IDs sorted in ascending order into a new sorted
+// slice. The result is undefined if either input is not sorted.
+func Merge(a, b []ID) []ID {
+	merged := make([]ID, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if b[j] < a[i] {
+			merged = append(merged, b[j])
+			j++
+		} else {
+			merged = append(merged, a[i])
+			i++
+		}
+	}
+	merged = append(merged, a[i:]...)
+	return append(merged, b[j:]...)
+}
+
+// EarliestPerWorker returns the earliest ID of every worker found in ids
+func EarliestPerWorker(ids []ID) map[uint64]ID {
+	earliest := make(map[uint64]ID)
+	for _, id := range ids {
+		// IDs of the same worker order by timestamp, then sequence.
+		if cur, ok := earliest[id.WorkerID()]; !ok || id < cur {
+			earliest[id.WorkerID()] = id
+		}
+	}
+	return earliest
+}
+
+// PartitionByWorker groups ids by their worker id, keeping the order of ids
+// within every group
+func PartitionByWorker(ids []ID) map[uint64][]ID {
+	partitions := make(map[uint64][]ID)
+	for _, id := range ids {
+		partitions[id.WorkerID()] = append(partitions[id.WorkerID()], id)
+	}
+	return partitions
+}
+
+// WorkerHistogram returns the number of IDs of every worker found in ids
+func WorkerHistogram(ids []ID) map[uint64]int {
+	counts := make(map[uint64]int)
+	for _, id := range ids {
+		counts[id.WorkerID()]++
+	}
+	return counts
+}
+
+// CountByBucket returns the number of IDs with the default layout created in
+// every bucket of length d, keyed by the UTC start time of the bucket. d must
+// be positive.
+func CountByBucket(ids []ID, d time.Duration) map[time.Time]int {
+	counts := make(map[time.Time]int)
+	for _, id := range ids {
+		counts[id.Time().Truncate(d)]++
+	}
+	return counts
+}
+
+// Disjoint reports whether a and b have no ID in common. If they do, it also
+// returns the first ID of b that is found in a.
+func Disjoint(a, b []ID) (bool, ID) {
+	seen := make(map[ID]struct{}, len(a))
+	for _, id := range a {
+		seen[id] = struct{}{}
+	}
+	for _, id := range b {
+		if _, ok := seen[id]; ok {
+			return false, id
+		}
+	}
+	return true, 0
+}
+
+// MedianTime returns the median creation time of IDs with the default layout.
+// Unlike the earliest or latest time, the median is not thrown off by a few
+// workers with a skewed clock. It returns the zero time for no IDs.
+func MedianTime(ids []ID) time.Time {
+	if len(ids) == 0 {
+		return time.Time{}
+	}
+	timestamps := make([]uint64, len(ids))
+	for i, id := range ids {
+		timestamps[i] = DefaultLayout.timestamp(id)
+	}
+	slices.Sort(timestamps)
+
+	mid := len(timestamps) / 2
+	median := timestamps[mid]
+	if len(timestamps)%2 == 0 {
+		median = timestamps[mid-1] + (median-timestamps[mid-1])/2
+	}
+	return Epoch.Add(time.Duration(median) * time.Millisecond).UTC()
+}
+
+// InterArrival returns the differences between the creation times of
+// consecutive IDs with the default layout, which should be sorted. IDs from the
+// same millisecond are zero apart.
+func InterArrival(ids []ID) []time.Duration {
+	if len(ids) < 2 {
+		return nil
+	}
+	gaps := make([]time.Duration, len(ids)-1)
+	for i := range gaps {
+		gaps[i] = ids[i+1].Time().Sub(ids[i].Time())
+	}
+	return gaps
+}
+
+// IDAtPercentile returns the first ID of ids, sorted in ascending order with
+// the default layout, created at or after the point p of the way from the
+// first to the last creation time, with p clamped to [0, 1]. Unlike picking
+// the element at position p, the result follows time, not the density of the
+// IDs. It returns the zero ID for no IDs.
+func IDAtPercentile(ids []ID, p float64) ID {
+	if len(ids) == 0 {
+		return 0
+	}
+	p = min(max(p, 0), 1)
+	first, last := ids[0].Time(), ids[len(ids)-1].Time()
+	target := first.Add(time.Duration(p * float64(last.Sub(first))))
+	i, _ := slices.BinarySearchFunc(ids, target, func(id ID, t time.Time) int {
+		return id.Time().Compare(t)
+	})
+	return ids[min(i, len(ids)-1)]
+}
+
+// Dedup forwards the IDs received from in, dropping every ID it has forwarded
+// before, and closes the returned channel when in is closed. It remembers every
+// ID it forwards, so its memory grows without bound; use DedupWindow for
+// long-running streams.
+func Dedup(in <-chan ID) <-chan ID {
+	out := make(chan ID)
+	go func() {
+		defer close(out)
+		seen := make(map[ID]struct{})
+		for id := range in {
+			if _, ok := seen[id]; ok {
+				continue
+			}
+			seen[id] = struct{}{}
+			out <- id
+		}
+	}()
+	return out
+}
+
+// DedupWindow is like Dedup but only remembers the last size IDs it
+// forwarded, so a duplicate arriving later than that is forwarded again.
+// size must be positive.
+func DedupWindow(in <-chan ID, size int) <-chan ID {
+	out := make(chan ID)
+	go func() {
+		defer close(out)
+		seen := make(map[ID]struct{}, size)
+		window := make([]ID, 0, size)
+		next := 0
+		for id := range in {
+			if _, ok := seen[id]; ok {
+				continue
+			}
+			if len(window) < size {
+				window = append(window, id)
+			} else {
+				delete(seen, window[next])
+				window[next] = id
+				next = (next + 1) % size
+			}
+			seen[id] = struct{}{}
+			out <- id
+		}
+	}()
+	return out
+}
+
+// SynthesizeIDs returns count IDs with the default layout and worker id
+// workerID, with creation times evenly spaced from start to end, for test
+// data. IDs falling into the same millisecond take consecutive sequence
+// numbers. It returns an error if the IDs do not fit into the window.
+func SynthesizeIDs(start, end time.Time, count int, workerID uint64) ([]ID, error) {
+	switch {
+	case start.Before(Epoch):
+		return nil, errors.New("start is before the epoch")
+	case end.Before(start):
+		return nil, errors.New("end is before start")
+	case count < 0:
+		return nil, errors.New("negative count")
+	case workerID > MaxWorkerID:
+		return nil, errors.New("worker id exceeds the worker bits")
+	}
+
+	first := uint64(start.Sub(Epoch) / time.Millisecond)
+	last := uint64(end.Sub(Epoch) / time.Millisecond)
+	if last > DefaultLayout.maxTimestamp() {
+		return nil, errors.New("end exceeds the timestamp range")
+	}
+
+	ids := make([]ID, count)
+	var prev, sequence uint64
+	for i := range ids {
+		ts := first
+		if count > 1 {
+			hi, lo := bits.Mul64(last-first, uint64(i))
+			q, _ := bits.Div64(hi, lo, uint64(count-1))
+			ts += q
+		}
+		switch {
+		case i == 0 || ts > prev:
+			sequence = 0
+		case sequence < MaxSequence:
+			ts = prev
+			sequence++
+		default:
+			ts = prev + 1
+			sequence = 0
+		}
+		if ts > last {
+			return nil, errors.New("too many IDs for the window")
+		}
+		prev = ts
+		ids[i] = DefaultLayout.pack(ts, 0, workerID, sequence)
+	}
+	return ids, nil
+}
@@ -0,0 +1,275 @@
+package flake
+
+import (
+	"slices"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestMerge(t *testing.T) {
+	a, b := New(1), New(2)
+
+	var left, right []ID
+	for i := 0; i < 50; i++ {
+		left = append(left, a.NextID())
+		right = append(right, b.NextID())
+	}
+
+	merged := Merge(left, right)
+	if len(merged) != len(left)+len(right) {
+		t.Fatalf("got %d IDs, want %d", len(merged), len(left)+len(right))
+	}
+	if !sort.SliceIsSorted(merged, func(i, j int) bool { return merged[i] < merged[j] }) {
+		t.Error("merged IDs are not sorted")
+	}
+
+	count := make(map[ID]int)
+	for _, id := range merged {
+		count[id]++
+	}
+	for _, id := range append(left, right...) {
+		if count[id] != 1 {
+			t.Errorf("ID %d appears %d times, want 1", id, count[id])
+		}
+	}
+
+	if got := Merge(nil, left[:2]); len(got) != 2 || got[0] != left[0] || got[1] != left[1] {
+		t.Errorf("Merge(nil, b) = %v, want %v", got, left[:2])
+	}
+}
+
+func TestEarliestPerWorker(t *testing.T) {
+	a, b := New(1), New(2)
+	start := time.Now()
+	freeze(a, start)
+	freeze(b, start.Add(time.Hour))
+
+	firstA, firstB := a.NextID(), b.NextID()
+	ids := []ID{b.NextID(), a.NextID(), firstB, a.NextID(), firstA, b.NextID()}
+
+	got := EarliestPerWorker(ids)
+	if len(got) != 2 || got[1] != firstA || got[2] != firstB {
+		t.Errorf("EarliestPerWorker() = %v, want map[1:%d 2:%d]", got, firstA, firstB)
+	}
+}
+
+func TestPartitionByWorker(t *testing.T) {
+	gens := []*Flake{New(1), New(2), New(3)}
+	var ids []ID
+	want := make(map[uint64][]ID)
+	for i := 0; i < 30; i++ {
+		f := gens[i*7%3]
+		id := f.NextID()
+		ids = append(ids, id)
+		want[id.WorkerID()] = append(want[id.WorkerID()], id)
+	}
+
+	got := PartitionByWorker(ids)
+	if len(got) != 3 {
+		t.Fatalf("PartitionByWorker() has %d partitions, want 3", len(got))
+	}
+	for worker, part := range want {
+		if !slices.Equal(got[worker], part) {
+			t.Errorf("partition %d = %v, want %v", worker, got[worker], part)
+		}
+		if !slices.IsSorted(got[worker]) {
+			t.Errorf("partition %d is not in order", worker)
+		}
+	}
+}
+
+func TestWorkerHistogram(t *testing.T) {
+	var ids []ID
+	for worker, n := range map[uint64]int{1: 3, 2: 5, 3: 1} {
+		f := New(worker)
+		for i := 0; i < n; i++ {
+			ids = append(ids, f.NextID())
+		}
+	}
+
+	got := WorkerHistogram(ids)
+	if len(got) != 3 || got[1] != 3 || got[2] != 5 || got[3] != 1 {
+		t.Errorf("WorkerHistogram() = %v, want map[1:3 2:5 3:1]", got)
+	}
+}
+
+func TestCountByBucket(t *testing.T) {
+	noon := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	f := New(1)
+	var ids []ID
+	for _, d := range []time.Duration{10 * time.Minute, 50 * time.Minute, 65 * time.Minute, 59*time.Minute + 59*time.Second} {
+		freeze(f, noon.Add(d))
+		ids = append(ids, f.NextID())
+	}
+
+	got := CountByBucket(ids, time.Hour)
+	if len(got) != 2 || got[noon] != 3 || got[noon.Add(time.Hour)] != 1 {
+		t.Errorf("CountByBucket() = %v, want 3 IDs at %v and 1 at %v", got, noon, noon.Add(time.Hour))
+	}
+}
+
+func TestDisjoint(t *testing.T) {
+	a, b := New(1), New(2)
+	var left, right []ID
+	for i := 0; i < 100; i++ {
+		left = append(left, a.NextID())
+		right = append(right, b.NextID())
+	}
+
+	if ok, id := Disjoint(left, right); !ok {
+		t.Errorf("Disjoint() found collision %d between different workers", id)
+	}
+
+	overlapping := append(right[:10:10], left[42], left[7])
+	if ok, id := Disjoint(left, overlapping); ok || id != left[42] {
+		t.Errorf("Disjoint() = %v, %d, want false, %d", ok, id, left[42])
+	}
+}
+
+func TestMedianTime(t *testing.T) {
+	at := time.Date(2024, 6, 1, 13, 0, 0, 0, time.UTC)
+	ids := []ID{
+		FirstIDAt(at.Add(3 * time.Second)),
+		FirstIDAt(at),
+		// A worker with its clock a year ahead.
+		FirstIDAt(at.AddDate(1, 0, 0)),
+		FirstIDAt(at.Add(time.Second)),
+		FirstIDAt(at.Add(2 * time.Second)),
+	}
+
+	if got, want := MedianTime(ids), at.Add(2*time.Second); !got.Equal(want) {
+		t.Errorf("MedianTime() = %v, want %v", got, want)
+	}
+	if got, want := MedianTime(ids[:4]), at.Add(2*time.Second); !got.Equal(want) {
+		t.Errorf("MedianTime(even) = %v, want %v", got, want)
+	}
+	if got := MedianTime(nil); !got.IsZero() {
+		t.Errorf("MedianTime(nil) = %v, want zero", got)
+	}
+}
+
+func TestInterArrival(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	f := New(1)
+	var ids []ID
+	for _, d := range []time.Duration{0, 0, 5 * time.Millisecond, time.Second} {
+		freeze(f, start.Add(d))
+		ids = append(ids, f.NextID())
+	}
+
+	want := []time.Duration{0, 5 * time.Millisecond, time.Second - 5*time.Millisecond}
+	if got := InterArrival(ids); !slices.Equal(got, want) {
+		t.Errorf("InterArrival() = %v, want %v", got, want)
+	}
+	if got := InterArrival(ids[:1]); len(got) != 0 {
+		t.Errorf("InterArrival() of one ID = %v, want none", got)
+	}
+}
+
+func TestIDAtPercentile(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	f := New(1)
+	var ids []ID
+	for i := 0; i <= 10; i++ {
+		freeze(f, start.Add(time.Duration(i)*time.Minute))
+		ids = append(ids, f.NextID())
+	}
+
+	tests := []struct {
+		p    float64
+		want ID
+	}{
+		{0.5, ids[5]},
+		{0, ids[0]},
+		{1, ids[10]},
+		{0.21, ids[3]},
+		{-1, ids[0]},
+		{2, ids[10]},
+	}
+	for _, tt := range tests {
+		if got := IDAtPercentile(ids, tt.p); got != tt.want {
+			t.Errorf("IDAtPercentile(%v) at %v, want %v", tt.p, got.Time(), tt.want.Time())
+		}
+	}
+
+	// Crowding the start with IDs does not move the temporal midpoint.
+	crowded := append([]ID{}, ids[0])
+	freeze(f, start)
+	for i := 0; i < 100; i++ {
+		crowded = append(crowded, f.NextID())
+	}
+	crowded = append(crowded, ids[1:]...)
+	slices.Sort(crowded)
+	if got := IDAtPercentile(crowded, 0.5); got != ids[5] {
+		t.Errorf("IDAtPercentile(0.5) of crowded IDs at %v, want %v", got.Time(), ids[5].Time())
+	}
+	if got := IDAtPercentile(nil, 0.5); got != 0 {
+		t.Errorf("IDAtPercentile(nil) = %d, want 0", got)
+	}
+}
+
+func TestDedup(t *testing.T) {
+	feed := func(ids ...ID) <-chan ID {
+		in := make(chan ID)
+		go func() {
+			defer close(in)
+			for _, id := range ids {
+				in <- id
+			}
+		}()
+		return in
+	}
+	drain := func(out <-chan ID) []ID {
+		var ids []ID
+		for id := range out {
+			ids = append(ids, id)
+		}
+		return ids
+	}
+
+	if got, want := drain(Dedup(feed(1, 2, 1, 3, 2))), []ID{1, 2, 3}; !slices.Equal(got, want) {
+		t.Errorf("Dedup() = %v, want %v", got, want)
+	}
+
+	// With a window of 2, 1 is forgotten once 2 and 3 have been forwarded.
+	if got, want := drain(DedupWindow(feed(1, 2, 2, 3, 1), 2)), []ID{1, 2, 3, 1}; !slices.Equal(got, want) {
+		t.Errorf("DedupWindow() = %v, want %v", got, want)
+	}
+}
+
+func TestSynthesizeIDs(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	end := start.Add(time.Second)
+
+	for _, count := range []int{1, 1000, 100000} {
+		ids, err := SynthesizeIDs(start, end, count, 9)
+		if err != nil {
+			t.Fatalf("count %d: %v", count, err)
+		}
+		if len(ids) != count {
+			t.Fatalf("count %d: got %d IDs", count, len(ids))
+		}
+		for i := 1; i < len(ids); i++ {
+			if ids[i] <= ids[i-1] {
+				t.Fatalf("count %d: ID %d is not after ID %d", count, i, i-1)
+			}
+		}
+		if got := ids[0].Time(); !got.Equal(start) {
+			t.Errorf("count %d: first ID at %v, want %v", count, got, start)
+		}
+		if got := ids[len(ids)-1].Time(); count > 1 && !got.Equal(end) {
+			t.Errorf("count %d: last ID at %v, want %v", count, got, end)
+		}
+		if ids[0].WorkerID() != 9 {
+			t.Errorf("count %d: worker = %d, want 9", count, ids[0].WorkerID())
+		}
+	}
+
+	if _, err := SynthesizeIDs(start, start.Add(time.Millisecond), int(3*(MaxSequence+1)), 1); err == nil {
+		t.Error("SynthesizeIDs() fit 3 milliseconds of IDs into 2")
+	}
+	if _, err := SynthesizeIDs(end, start, 10, 1); err == nil {
+		t.Error("SynthesizeIDs() accepted an end before start")
+	}
+}
@@ -0,0 +1,89 @@
+package flake
+
+import (
+	"errors"
+	"math/bits"
+)
+
+// Layout describes how the 64 bits of an ID are divided between its fields.
+// From the most to the least significant bits an ID holds the timestamp, the
+// tag, the worker id and the sequence.
+type Layout struct {
+	TimestampBits uint
+	TagBits       uint
+	WorkerBits    uint
+	SequenceBits  uint
+}
+
+// DefaultLayout is the 41/10/13 layout used by New.
+var DefaultLayout = Layout{
+	TimestampBits: TimestampBits,
+	WorkerBits:    HostBits,
+	SequenceBits:  SequenceBits,
+}
+
+// WorkerBitsFor returns the number of worker bits needed to give each of nodes
+// workers its own worker id. A single worker needs no worker bits.
+func WorkerBitsFor(nodes int) (uint, error) {
+	if nodes < 1 {
+		return 0, errors.New("number of nodes must be positive")
+	}
+	return uint(bits.Len64(uint64(nodes - 1))), nil
+}
+
+// validate reports whether the layout describes a usable ID.
+func (l Layout) validate() error {
+	if l.TimestampBits == 0 {
+		return errors.New("layout has no timestamp bits")
+	}
+	// A layout may use all 64 bits, as the default layout does, rather than
+	// keeping the top bit free for signed integers; ID.Int64 checks it instead.
+	if l.TimestampBits+l.TagBits+l.WorkerBits+l.SequenceBits > 64 {
+		return errors.New("layout does not fit in 64 bits")
+	}
+	return nil
+}
+
+func (l Layout) maxTimestamp() uint64 { return mask(l.TimestampBits) }
+func (l Layout) maxTag() uint64       { return mask(l.TagBits) }
+func (l Layout) maxWorker() uint64    { return mask(l.WorkerBits) }
+func (l Layout) maxSequence() uint64  { return mask(l.SequenceBits) }
+
+func (l Layout) workerShift() uint    { return l.SequenceBits }
+func (l Layout) tagShift() uint       { return l.workerShift() + l.WorkerBits }
+func (l Layout) timestampShift() uint { return l.tagShift() + l.TagBits }
+
+// foldWorker maps an arbitrary worker id into the layout's worker range the
+// same way New does, by keeping its low bits.
+func (l Layout) foldWorker(workerID uint64) uint64 {
+	return workerID & l.maxWorker()
+}
+
+// pack assembles an ID from its fields, dropping bits that overflow them.
+func (l Layout) pack(timestamp, tag, workerID, sequence uint64) ID {
+	return ID((timestamp&l.maxTimestamp())<<l.timestampShift() |
+		(tag&l.maxTag())<<l.tagShift() |
+		(workerID&l.maxWorker())<<l.workerShift() |
+		sequence&l.maxSequence())
+}
+
+func (l Layout) timestamp(id ID) uint64 {
+	return uint64(id) >> l.timestampShift() & l.maxTimestamp()
+}
+
+func (l Layout) tag(id ID) uint64 {
+	return uint64(id) >> l.tagShift() & l.maxTag()
+}
+
+func (l Layout) worker(id ID) uint64 {
+	return uint64(id) >> l.workerShift() & l.maxWorker()
+}
+
+func (l Layout) sequence(id ID) uint64 {
+	return uint64(id) & l.maxSequence()
+}
+
+// mask returns a value with the lowest bits bits set.
+func mask(bits uint) uint64 {
+	return ^uint64(0) >> (64 - bits)
+}
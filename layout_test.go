@@ -0,0 +1,36 @@
+package flake
+
+import "testing"
+
+func TestWorkerBitsFor(t *testing.T) {
+	tests := []struct {
+		nodes int
+		want  uint
+	}{
+		{1, 0},
+		{2, 1},
+		{3, 2},
+		{4, 2},
+		{5, 3},
+		{100, 7},
+		{128, 7},
+		{129, 8},
+		{1024, 10},
+	}
+	for _, tt := range tests {
+		got, err := WorkerBitsFor(tt.nodes)
+		if err != nil {
+			t.Errorf("WorkerBitsFor(%d) error: %v", tt.nodes, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("WorkerBitsFor(%d) = %d, want %d", tt.nodes, got, tt.want)
+		}
+	}
+
+	for _, nodes := range []int{0, -1} {
+		if _, err := WorkerBitsFor(nodes); err == nil {
+			t.Errorf("WorkerBitsFor(%d) did not fail", nodes)
+		}
+	}
+}
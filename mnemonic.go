@@ -0,0 +1,93 @@
+package flake
+
+import (
+	"fmt"
+	"strings"
+)
+
+// mnemonicWords holds the 256 words of a mnemonic, one for every byte value.
+// The words are distinct, common and easy to spell.
+var mnemonicWords = [256]string{
+	"acorn", "actor", "adobe", "agent", "album", "alert", "alley",
+	"alpha", "angle", "apple", "apron", "arena", "atlas", "attic",
+	"audio", "award", "badge", "bagel", "baker", "banjo", "basil",
+	"beach", "beard", "bench", "bison", "blade", "blank", "blaze",
+	"board", "bonus", "boost", "brain", "brick", "broom", "brush",
+	"bucket", "buddy", "cabin", "cable", "cactus", "camel", "candy",
+	"canoe", "canyon", "cargo", "castle", "cedar", "chalk", "charm",
+	"chief", "chili", "cider", "cinema", "citrus", "clock", "cloud",
+	"clover", "cobra", "cocoa", "comet", "coral", "couch", "crane",
+	"crater", "cream", "crown", "curry", "daisy", "dance", "delta",
+	"depot", "desert", "diary", "diesel", "donut", "dragon", "drama",
+	"dream", "dune", "eagle", "easel", "echo", "elder", "empire",
+	"engine", "enigma", "essay", "event", "fabric", "falcon", "farm",
+	"feast", "fence", "ferry", "fiesta", "filter", "flame", "flute",
+	"focus", "fossil", "frost", "fruit", "fudge", "garden", "gecko",
+	"genie", "ghost", "ginger", "globe", "glove", "goose", "gravel",
+	"guitar", "habit", "hammer", "harp", "hazel", "helmet", "hero",
+	"hornet", "hotel", "humor", "igloo", "iris", "island", "ivory",
+	"jacket", "jaguar", "jewel", "jigsaw", "jockey", "judge", "jungle",
+	"kayak", "kettle", "kiwi", "label", "ladder", "lagoon", "lamp",
+	"lava", "lemon", "lens", "lily", "linen", "lion", "lobby", "locker",
+	"lunar", "magnet", "mango", "maple", "meadow", "medal", "melon",
+	"metro", "mocha", "model", "monkey", "moose", "motor", "museum",
+	"nectar", "needle", "nickel", "noodle", "nova", "nugget", "oasis",
+	"olive", "omega", "onion", "opera", "orchid", "otter", "oyster",
+	"paddle", "panda", "paper", "parrot", "pasta", "pearl", "pebble",
+	"pencil", "pepper", "pilot", "pixel", "planet", "plaza", "polar",
+	"pony", "poppy", "potato", "prism", "quartz", "quest", "quilt",
+	"rabbit", "radio", "raven", "razor", "reef", "ribbon", "robot",
+	"rocket", "rodeo", "saddle", "salad", "salmon", "salsa", "satin",
+	"sauna", "scarf", "shadow", "shell", "silver", "sketch", "slate",
+	"solar", "sonic", "spice", "spider", "squid", "staple", "statue",
+	"stone", "storm", "summit", "sunset", "surf", "swan", "table",
+	"taco", "talent", "tango", "tiger", "timber", "toast", "tomato",
+	"torch", "tower", "tulip", "tundra", "tuxedo", "urban", "velvet",
+	"violin", "wafer", "walnut", "walrus", "wasabi", "wizard", "yacht",
+	"yogurt", "zebra", "zigzag",
+}
+
+// mnemonicIndex maps every word of mnemonicWords to its byte value.
+var mnemonicIndex = func() map[string]byte {
+	index := make(map[string]byte, len(mnemonicWords))
+	for i, w := range mnemonicWords {
+		index[w] = byte(i)
+	}
+	return index
+}()
+
+// Mnemonic formats the ID as up to 8 words separated by spaces, one for every
+// byte from the first non-zero one, for reading IDs out over the phone. The
+// first byte of a generated ID is not zero, so it always takes 8 words of 4 to
+// 6 letters, at most 55 characters.
+func (id ID) Mnemonic() string {
+	var b strings.Builder
+	for shift := 56; shift >= 0; shift -= 8 {
+		if id>>shift == 0 && shift > 0 {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(mnemonicWords[byte(id>>shift)])
+	}
+	return b.String()
+}
+
+// ParseMnemonic parses an ID formatted by ID.Mnemonic. Words are matched case
+// insensitively and may be separated by any amount of whitespace.
+func ParseMnemonic(s string) (ID, error) {
+	words := strings.Fields(s)
+	if len(words) == 0 || len(words) > 8 {
+		return 0, fmt.Errorf("invalid mnemonic %q", s)
+	}
+	var id ID
+	for _, w := range words {
+		v, ok := mnemonicIndex[strings.ToLower(w)]
+		if !ok {
+			return 0, fmt.Errorf("invalid mnemonic %q: unknown word %q", s, w)
+		}
+		id = id<<8 | ID(v)
+	}
+	return id, nil
+}
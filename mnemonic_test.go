@@ -0,0 +1,54 @@
+package flake
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestMnemonic(t *testing.T) {
+	for _, id := range []ID{0, 1, 255, 256, math.MaxUint64, New(1).NextID()} {
+		s := id.Mnemonic()
+		got, err := ParseMnemonic(s)
+		if err != nil {
+			t.Errorf("ParseMnemonic(%q) error: %v", s, err)
+			continue
+		}
+		if got != id {
+			t.Errorf("ParseMnemonic(%q) = %d, want %d", s, got, id)
+		}
+	}
+
+	if s := New(1).NextID().Mnemonic(); len(strings.Fields(s)) != 8 || len(s) > 55 {
+		t.Errorf("Mnemonic() of a generated ID = %q, want 8 words in at most 55 characters", s)
+	}
+	if got := ID(0).Mnemonic(); got != "acorn" {
+		t.Errorf("Mnemonic() of 0 = %q, want %q", got, "acorn")
+	}
+	if got := ID(1<<8 | 2).Mnemonic(); got != "actor adobe" {
+		t.Errorf("Mnemonic() of 258 = %q, want %q", got, "actor adobe")
+	}
+	if n := len(strings.Fields(New(1).NextID().Mnemonic())); n != 8 {
+		t.Errorf("Mnemonic() of a generated ID has %d words, want 8", n)
+	}
+}
+
+func TestParseMnemonicWhitespace(t *testing.T) {
+	id := New(1).NextID()
+	s := "  " + strings.ToUpper(strings.ReplaceAll(id.Mnemonic(), " ", " \t\n ")) + "\n"
+	if got, err := ParseMnemonic(s); err != nil || got != id {
+		t.Errorf("ParseMnemonic(%q) = %d, %v, want %d", s, got, err, id)
+	}
+
+	for _, s := range []string{"", "   ", "acorn banana", strings.Repeat("acorn ", 9)} {
+		if _, err := ParseMnemonic(s); err == nil {
+			t.Errorf("ParseMnemonic(%q) did not fail", s)
+		}
+	}
+}
+
+func TestMnemonicWords(t *testing.T) {
+	if len(mnemonicIndex) != len(mnemonicWords) {
+		t.Errorf("mnemonic words are not distinct: %d of %d", len(mnemonicIndex), len(mnemonicWords))
+	}
+}
@@ -0,0 +1,64 @@
+package flake
+
+import (
+	"context"
+	"time"
+)
+
+// Stats holds counters of a generator since its creation
+type Stats struct {
+	// Generated is the number of IDs generated, including reserved ones.
+	Generated uint64
+
+	// Overflows is the number of times the sequence numbers of a timestamp
+	// ran out and the generator moved on to the next timestamp early.
+	Overflows uint64
+
+	// ClockBackwards is the number of times the clock was found behind the
+	// last timestamp by more than the configured tolerance.
+	ClockBackwards uint64
+}
+
+// Stats returns the counters of the generator
+func (f *Flake) Stats() Stats {
+	var st Stats
+	for _, s := range f.shards {
+		f.lock(s)
+		st.Generated += s.generated
+		st.Overflows += s.overflows
+		st.ClockBackwards += s.backwards
+		f.unlock(s)
+	}
+	return st
+}
+
+// Drift returns how far the last timestamp used by the generator is ahead of
+// the clock, after a burst of IDs or when the clock moved backwards. It is
+// zero when the generator is in step with the clock.
+func (f *Flake) Drift() time.Duration {
+	now := f.getTimestamp()
+	var lead uint64
+	for _, s := range f.shards {
+		f.lock(s)
+		if s.prevTime > now {
+			lead = max(lead, s.prevTime-now)
+		}
+		f.unlock(s)
+	}
+	return time.Duration(lead) * f.unit
+}
+
+// StartMonitor calls report with the generator's Stats and Drift every
+// interval from a new goroutine, until ctx is done. It panics if the generator
+// was created with WithUnsafeNoLock, as the monitor would then read the
+// generator while it generates IDs.
+func (f *Flake) StartMonitor(ctx context.Context, interval time.Duration, report func(Stats, time.Duration)) {
+	if f.nolock {
+		panic("flake: StartMonitor needs a generator without WithUnsafeNoLock")
+	}
+	go func() {
+		for f.sleep(ctx, interval) == nil {
+			report(f.Stats(), f.Drift())
+		}
+	}()
+}
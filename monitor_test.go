@@ -0,0 +1,91 @@
+package flake
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	at := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	f := New(1)
+	freeze(f, at)
+
+	for i := uint64(0); i < MaxSequence+2; i++ {
+		f.NextID()
+	}
+	f.Reserve(10)
+	if got, want := f.Stats(), (Stats{Generated: MaxSequence + 12, Overflows: 1}); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+	if got := f.Drift(); got != time.Millisecond {
+		t.Errorf("Drift() = %v, want 1ms", got)
+	}
+
+	f.now = func() time.Time { return at.Add(-time.Second) }
+	f.NextID()
+	if got := f.Stats().ClockBackwards; got != 1 {
+		t.Errorf("ClockBackwards = %d, want 1", got)
+	}
+}
+
+func TestStartMonitor(t *testing.T) {
+	f := New(1)
+	stopped := make(chan struct{})
+	f.sleep = func(ctx context.Context, d time.Duration) error {
+		if err := ctx.Err(); err != nil {
+			close(stopped)
+			return err
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	calls := 0
+	f.StartMonitor(ctx, time.Minute, func(st Stats, drift time.Duration) {
+		calls++
+		if calls == 3 {
+			cancel()
+		}
+	})
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("monitor did not stop after cancel")
+	}
+	if calls != 3 {
+		t.Errorf("report called %d times, want 3", calls)
+	}
+}
+
+func TestStartMonitorConcurrent(t *testing.T) {
+	f := New(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var calls atomic.Int64
+	f.StartMonitor(ctx, time.Millisecond, func(Stats, time.Duration) { calls.Add(1) })
+
+	// Run with -race: the monitor reads the shards while IDs are generated.
+	for deadline := time.Now().Add(5 * time.Second); calls.Load() < 3 && time.Now().Before(deadline); {
+		f.NextID()
+	}
+	if calls.Load() < 3 {
+		t.Error("monitor did not report while IDs were generated")
+	}
+}
+
+func TestStartMonitorNoLock(t *testing.T) {
+	f, err := NewWithOptions(1, WithUnsafeNoLock())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("StartMonitor did not panic for a generator without locking")
+		}
+	}()
+	f.StartMonitor(context.Background(), time.Minute, func(Stats, time.Duration) {})
+}
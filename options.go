@@ -0,0 +1,316 @@
+package flake
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Option configures a generator created by NewWithOptions.
+type Option func(*Flake)
+
+// validateConfig checks that the options applied to f describe a usable
+// generator.
+func (f *Flake) validateConfig() error {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: "+format, append([]interface{}{ErrInvalidConfig}, args...)...)
+	}
+
+	if err := f.layout.validate(); err != nil {
+		return invalid("%v", err)
+	}
+	if f.epoch.After(f.now()) {
+		return invalid("epoch %v is in the future: %w", f.epoch, ErrBeforeEpoch)
+	}
+	if f.resolution < f.unit || f.resolution%f.unit != 0 {
+		return invalid("time resolution %v is not a whole multiple of %v", f.resolution, f.unit)
+	}
+	if f.resolution > f.unit && f.layout.SequenceBits == 0 {
+		return invalid("time resolution %v needs sequence bits", f.resolution)
+	}
+	if uint64(f.resolution/f.unit) > f.layout.maxTimestamp() {
+		return invalid("time resolution %v exceeds the timestamp range", f.resolution)
+	}
+	if f.prefix != "" && isBase36Digit(f.prefix[len(f.prefix)-1]) {
+		return invalid("string prefix %q does not end with a separator", f.prefix)
+	}
+	if f.format == Binary || f.format.maxLen() == 0 {
+		return invalid("format %d is not a string encoding", f.format)
+	}
+	if f.crashPath != "" && f.crashEvery < f.unit {
+		return invalid("crash marker interval %v is shorter than %v", f.crashEvery, f.unit)
+	}
+	if f.refresh != nil && f.nolock {
+		return invalid("worker id refresh cannot be combined with WithUnsafeNoLock")
+	}
+	if f.rateLimit < 0 {
+		return invalid("rate limit %d is negative", f.rateLimit)
+	}
+	if f.saltBits >= f.layout.SequenceBits && f.saltBits > 0 {
+		return invalid("salt needs %d of %d sequence bits", f.saltBits, f.layout.SequenceBits)
+	}
+	if f.saltBits+f.prioBits >= f.layout.SequenceBits && f.prioBits > 0 {
+		return invalid("priority needs %d of the %d free sequence bits", f.prioBits, f.layout.SequenceBits-f.saltBits)
+	}
+	if f.shardCount < 1 {
+		return invalid("shard count %d is not positive", f.shardCount)
+	}
+	// Every shard needs a sequence number of its own in each resolution step,
+	// out of the sequence numbers the salt and priority bits leave.
+	if uint64(f.shardCount) > f.counterMax()+1 {
+		return invalid("shard count %d leaves no sequence numbers per %v step, as %d are free", f.shardCount, f.resolution, f.counterMax()+1)
+	}
+	return nil
+}
+
+// WithEpoch sets the epoch the embedded timestamps count from.
+func WithEpoch(epoch time.Time) Option {
+	return func(f *Flake) {
+		f.epoch = epoch
+	}
+}
+
+// WithLayout sets the bit layout of the generated IDs.
+func WithLayout(l Layout) Option {
+	return func(f *Flake) {
+		f.layout = l
+	}
+}
+
+// WithSequenceShards splits the sequence space between n independently locked
+// shards. Concurrent callers are spread across the shards and contend less,
+// at the cost of using the sequence space less densely. IDs stay unique and
+// roughly ordered.
+func WithSequenceShards(n int) Option {
+	return func(f *Flake) {
+		f.shardCount = n
+	}
+}
+
+// WithDescending stores the complement of the timestamp so that IDs generated
+// later are numerically smaller, letting range scans return the newest IDs
+// first. IDs generated within the same millisecond still increase. Descending
+// and ascending IDs cannot be compared with each other; use the generator's
+// Time method to decode them.
+func WithDescending() Option {
+	return func(f *Flake) {
+		f.descending = true
+	}
+}
+
+// WithForkDetection makes the generator check the process id before every ID
+// and switch to a new random worker id when it changed since construction.
+// This protects processes that fork after creating a generator, at the cost
+// of a getpid system call per ID.
+func WithForkDetection() Option {
+	return func(f *Flake) {
+		f.getpid = os.Getpid
+	}
+}
+
+// WithTimeResolution truncates the embedded timestamp to a multiple of d, so
+// an ID does not reveal the exact millisecond it was created in. IDs created
+// within the same interval are only ordered by their sequence, and a worker
+// can create at most 2^SequenceBits IDs per interval before the timestamp
+// runs ahead of the clock, or fewer with WithInstanceSalt, WithPriorityBits or
+// WithSequenceShards. NewWithOptions rejects a configuration that leaves a
+// shard less than one sequence number per interval. d must be a whole number
+// of milliseconds.
+func WithTimeResolution(d time.Duration) Option {
+	return func(f *Flake) {
+		f.resolution = d
+	}
+}
+
+// WithNanosecondSingleWorker gives the whole ID to a nanosecond timestamp,
+// leaving no worker or sequence bits. IDs are ordered to the nanosecond, and
+// IDs requested within the same nanosecond take the following nanoseconds.
+// Only a single generator may use this mode, as there is no worker id to tell
+// generators apart. Use the generator's Time method to decode the IDs.
+func WithNanosecondSingleWorker() Option {
+	return func(f *Flake) {
+		f.layout = Layout{TimestampBits: 64}
+		f.unit = time.Nanosecond
+		f.resolution = time.Nanosecond
+	}
+}
+
+// WithRandomSequence starts the sequence of every timestamp at a random value
+// in the lower half of the sequence space, so IDs do not reveal how many IDs
+// were generated before them. This halves the number of IDs a worker is
+// guaranteed to generate per timestamp.
+func WithRandomSequence() Option {
+	return func(f *Flake) {
+		f.randomSeq = true
+	}
+}
+
+// WithClockBackwardTolerance makes the generator wait for the clock to catch
+// up when it moves backwards by at most d, so that small NTP corrections heal
+// without reusing timestamps. Larger steps are handled as described by NextID
+// and NextIDContext.
+func WithClockBackwardTolerance(d time.Duration) Option {
+	return func(f *Flake) {
+		f.tolerance = d
+	}
+}
+
+// WithStuckClockDetection makes NextIDContext return ErrClockStuck when the
+// clock keeps returning the same time while IDs are requested, as on a broken
+// host, and running out of sequence numbers has moved the generator on by more
+// than threshold since. Leading a clock that advances, as after a burst, is
+// not detected. NextID keeps generating IDs ahead of the clock.
+func WithStuckClockDetection(threshold time.Duration) Option {
+	return func(f *Flake) {
+		f.stuckAfter = threshold
+	}
+}
+
+// WithCatchUp brings a generator that is ahead of the clock back to the
+// current time, and keeps it there. Without it, a generator that used up the
+// sequence numbers of its last timestamp moves on to the next one even when
+// that is ahead of the clock, so after a burst, FillIDs, Reserve or SyncFrom
+// its IDs can stay ahead as long as the load lasts. With it, NextID, FillIDs
+// and Reserve wait for the clock to pass the last timestamp instead: the lead
+// shrinks as the clock advances, and once it is gone IDs carry the current
+// time. IDs never go below a timestamp already used, so the lead closes at the
+// pace of the clock, and bursts are limited to the sequence numbers of one
+// timestamp per timestamp. This includes a clock that moved backwards beyond
+// the tolerance, which NextID then waits for; NextIDContext returns
+// ErrClockBackwards first, and gives up waiting when its context is done.
+func WithCatchUp() Option {
+	return func(f *Flake) {
+		f.catchUp = true
+	}
+}
+
+// WithRateLimit limits the generator to perSecond IDs per second, allowing
+// bursts of up to perSecond IDs. NextID blocks until the limit allows another
+// ID, while NextIDContext also gives up when its context is done. Zero means
+// no limit.
+func WithRateLimit(perSecond int) Option {
+	return func(f *Flake) {
+		f.rateLimit = perSecond
+	}
+}
+
+// WithStringPrefix makes NextStringID prepend p to the IDs it formats, as in
+// ord_2zv8k1s0c1w, so that IDs describe what they identify. p must end with a
+// character that is not a base36 digit, such as an underscore, to keep it
+// apart from the ID.
+func WithStringPrefix(p string) Option {
+	return func(f *Flake) {
+		f.prefix = p
+	}
+}
+
+func isBase36Digit(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// WithDefaultFormat sets the encoding NextStringID, Format and Parse use
+// instead of base36. Binary is not a string encoding and is rejected.
+// The FormattedID values of the generator, as returned by Formatted and
+// NextFormattedID, use the format for String and their text and JSON
+// encodings too; a plain ID has no generator to consult and stays base36.
+func WithDefaultFormat(e Encoding) Option {
+	return func(f *Flake) {
+		f.format = e
+	}
+}
+
+// WithCheckChar makes NextStringID and Format append a check character to the
+// formatted ID, which Parse validates and strips, to catch IDs mistyped by
+// people. With the base62 format, the strings can be parsed by ParseChecked.
+func WithCheckChar() Option {
+	return func(f *Flake) {
+		f.checked = true
+	}
+}
+
+// WithCrashSafety makes the generator record a marker in the file at path
+// about every interval, holding a timestamp two intervals ahead of the last
+// one used. On creation, the generator passes the marker to SyncFrom, so that
+// after a crash it never reuses a timestamp even if the clock moved back a
+// little. Markers are written in the background and write errors are
+// ignored; a missing marker file is not an error.
+func WithCrashSafety(path string, interval time.Duration) Option {
+	return func(f *Flake) {
+		f.crashPath = path
+		f.crashEvery = interval
+	}
+}
+
+// WithReplayLog makes the generator write every ID to w as 8 big endian bytes
+// before handing it out. After a restart, the last ID of the log can be passed
+// to SyncFrom so that no ID is reused. NextID ignores write errors, while
+// NextIDContext returns them.
+func WithReplayLog(w io.Writer) Option {
+	return func(f *Flake) {
+		f.replay = w
+	}
+}
+
+// WithUnsafeNoLock makes NextID skip locking. The generator is then NOT safe
+// for concurrent use: calling it from more than one goroutine at a time
+// generates duplicate IDs. Only use it when the caller serializes all calls.
+func WithUnsafeNoLock() Option {
+	return func(f *Flake) {
+		f.nolock = true
+	}
+}
+
+// WithInstanceSalt sets the highest sequence bit of every ID to a random value
+// drawn once per generator, so that IDs follow a different pattern from one
+// run to the next. IDs stay unique, but a worker can only generate half as
+// many IDs per timestamp.
+func WithInstanceSalt() Option {
+	return WithStartupNonce(1)
+}
+
+// WithStartupNonce sets the n highest sequence bits of every ID to a random
+// nonce drawn once per generator, so that two runs sharing a worker id, such
+// as a process restarted with a persisted worker id while the clock stepped
+// back, most likely generate different IDs. A worker can then only generate
+// 1/2^n as many IDs per timestamp.
+func WithStartupNonce(n uint) Option {
+	return func(f *Flake) {
+		f.saltBits = n
+	}
+}
+
+// WithForbidZeroWorker rejects a worker id that folds to zero, which a host
+// address or hash can yield by accident and which overlaps with generators
+// left at the default worker id. NewWithOptions then returns an error, or if
+// remap is true, replaces the worker id by a non-zero one derived from a hash
+// of the original.
+func WithForbidZeroWorker(remap bool) Option {
+	return func(f *Flake) {
+		f.forbidZero = true
+		f.remapZero = remap
+	}
+}
+
+// WithPriorityBits reserves the n high sequence bits below the salt for the
+// priority passed to NextIDPriority. A worker can then only generate 1/2^n as
+// many IDs per timestamp.
+func WithPriorityBits(n uint) Option {
+	return func(f *Flake) {
+		f.prioBits = n
+	}
+}
+
+// WithIDRefresh makes the generator derive its worker id from the host address
+// again, as WithHostID does, at most once every interval, for hosts whose
+// address changes. The worker id passed to NewWithOptions is kept for the
+// first interval. After that, the worker id is derived in the background when
+// an ID is requested. When it changed, IDs with the new worker id
+// start at a later timestamp than the last ID with the old one, so the IDs of
+// the generator stay in order, but IDs of both worker ids belong to it. It
+// cannot be combined with WithUnsafeNoLock.
+func WithIDRefresh(interval time.Duration) Option {
+	return func(f *Flake) {
+		f.refresh = &workerRefresh{interval: interval}
+	}
+}
@@ -0,0 +1,141 @@
+package flake
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		opts []Option
+		msg  string
+	}{
+		{[]Option{WithLayout(Layout{WorkerBits: 10, SequenceBits: 13})}, "no timestamp bits"},
+		{[]Option{WithLayout(Layout{TimestampBits: 42, WorkerBits: 10, SequenceBits: 13})}, "does not fit in 64 bits"},
+		{[]Option{WithEpoch(time.Now().Add(time.Hour))}, "is in the future"},
+		{[]Option{WithTimeResolution(time.Microsecond)}, "not a whole multiple"},
+		{[]Option{WithLayout(Layout{TimestampBits: 41}), WithTimeResolution(time.Second)}, "needs sequence bits"},
+		{[]Option{WithLayout(Layout{TimestampBits: 4, SequenceBits: 13}), WithTimeResolution(time.Second)}, "exceeds the timestamp range"},
+		{[]Option{WithStringPrefix("ord")}, "does not end with a separator"},
+		{[]Option{WithDefaultFormat(Binary)}, "not a string encoding"},
+		{[]Option{WithInstanceSalt(), WithPriorityBits(12)}, "priority needs 12 of the 12 free"},
+		{[]Option{WithIDRefresh(time.Minute), WithUnsafeNoLock()}, "cannot be combined with WithUnsafeNoLock"},
+		{[]Option{WithSequenceShards(0)}, "shard count 0"},
+		{[]Option{WithSequenceShards(1 << 14)}, "shard count 16384"},
+		{[]Option{WithTimeResolution(time.Second), WithPriorityBits(10), WithSequenceShards(16)}, "leaves no sequence numbers per 1s step, as 8 are free"},
+	}
+	for _, tt := range tests {
+		_, err := NewWithOptions(1, tt.opts...)
+		if !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s: error = %v, want ErrInvalidConfig", tt.msg, err)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.msg) {
+			t.Errorf("error = %q, want it to mention %q", err, tt.msg)
+		}
+	}
+
+	if _, err := NewWithOptions(1, WithEpoch(time.Now().Add(-time.Hour))); err != nil {
+		t.Errorf("valid config rejected: %v", err)
+	}
+	// Layouts may use the top bit.
+	if _, err := NewWithOptions(1, WithLayout(Layout{TimestampBits: 40, WorkerBits: 10, SequenceBits: 14})); err != nil {
+		t.Errorf("64-bit layout rejected: %v", err)
+	}
+}
+
+func TestStringPrefix(t *testing.T) {
+	f, err := NewWithOptions(1, WithStringPrefix("ord_"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := f.NextStringID()
+	if !strings.HasPrefix(s, "ord_") {
+		t.Fatalf("NextStringID() = %q, want prefix ord_", s)
+	}
+	id, err := f.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if "ord_"+id.String() != s {
+		t.Errorf("Parse(%q) = %s", s, id)
+	}
+
+	for _, s := range []string{strings.TrimPrefix(s, "ord_"), "usr_" + id.String(), "ord_"} {
+		if _, err := f.Parse(s); err == nil {
+			t.Errorf("Parse(%q) expected an error", s)
+		}
+	}
+}
+
+func TestDefaultFormat(t *testing.T) {
+	f, err := NewWithOptions(1, WithDefaultFormat(Hex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := f.NextStringID()
+	if len(s) != 16 || strings.Trim(s, "0123456789abcdef") != "" {
+		t.Fatalf("NextStringID() = %q, want 16 lowercase hex digits", s)
+	}
+	id, err := f.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Hex() != s {
+		t.Errorf("Parse(%q) = %s", s, id.Hex())
+	}
+
+	for _, e := range []Encoding{Decimal, Base36, Base62} {
+		f, err := NewWithOptions(1, WithDefaultFormat(e))
+		if err != nil {
+			t.Fatal(err)
+		}
+		id := f.NextID()
+		if got, err := f.Parse(f.Format(id)); err != nil || got != id {
+			t.Errorf("encoding %d: Parse(%q) = %d, %v, want %d", e, f.Format(id), got, err, id)
+		}
+	}
+}
+
+func TestForbidZeroWorker(t *testing.T) {
+	// The low 10 bits of 10.0.4.0 are zero.
+	stubHost(t,
+		func() (string, error) { return "api-0", nil },
+		func(string) ([]net.IP, error) { return []net.IP{net.IPv4(10, 0, 4, 0)}, nil })
+	workerID, err := getHostID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewWithOptions(workerID, WithForbidZeroWorker(false)); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("NewWithOptions() error = %v, want %v", err, ErrInvalidConfig)
+	}
+
+	f, err := NewWithOptions(workerID, WithForbidZeroWorker(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewWithOptions(workerID, WithForbidZeroWorker(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := f.NextID().WorkerID()
+	if got == 0 {
+		t.Error("remapped worker id is zero")
+	}
+	if other := g.NextID().WorkerID(); other != got {
+		t.Errorf("remapped worker ids differ: %d and %d", got, other)
+	}
+
+	f, err = NewWithOptions(7, WithForbidZeroWorker(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.NextID().WorkerID(); got != 7 {
+		t.Errorf("worker = %d, want 7", got)
+	}
+}
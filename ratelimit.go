@@ -0,0 +1,46 @@
+package flake
+
+import (
+	"sync"
+	"time"
+)
+
+// limiter is a token bucket holding up to one second worth of tokens.
+type limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(perSecond int, now time.Time) *limiter {
+	return &limiter{rate: float64(perSecond), tokens: float64(perSecond), last: now}
+}
+
+// reserve takes n tokens and returns how long the caller has to wait before
+// the tokens are available.
+func (l *limiter) reserve(now time.Time, n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if elapsed := now.Sub(l.last); elapsed > 0 {
+		l.tokens += elapsed.Seconds() * l.rate
+		if l.tokens > l.rate {
+			l.tokens = l.rate
+		}
+		l.last = now
+	}
+
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// cancel returns n tokens the caller gave up waiting for.
+func (l *limiter) cancel(n int) {
+	l.mu.Lock()
+	l.tokens += float64(n)
+	l.mu.Unlock()
+}
@@ -0,0 +1,68 @@
+package flake
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	f, err := NewWithOptions(1, WithRateLimit(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sleeping advances a fake clock instead of waiting.
+	at := time.Now()
+	f.now = func() time.Time { return at }
+	f.sleep = func(ctx context.Context, d time.Duration) error {
+		at = at.Add(d)
+		return nil
+	}
+	f.limiter = newLimiter(100, at)
+
+	start := at
+	for i := 0; i < 300; i++ {
+		f.NextID()
+	}
+
+	// The first 100 IDs use the burst, the other 200 take two seconds.
+	if elapsed := at.Sub(start); elapsed < 1990*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("generating 300 IDs took %v, want 2s", elapsed)
+	}
+}
+
+func TestRateLimitFillIDs(t *testing.T) {
+	f, err := NewWithOptions(1, WithRateLimit(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Now()
+	f.now = func() time.Time { return at }
+	f.sleep = func(ctx context.Context, d time.Duration) error {
+		at = at.Add(d)
+		return nil
+	}
+	f.limiter = newLimiter(10, at)
+
+	// The first 10 IDs use the burst, the other 990 take 99 seconds.
+	start := at
+	f.FillIDs(make([]ID, 1000))
+	if elapsed := at.Sub(start); elapsed < 98*time.Second || elapsed > 99*time.Second {
+		t.Errorf("filling 1000 IDs took %v, want 99s", elapsed)
+	}
+}
+
+func TestRateLimitCanceled(t *testing.T) {
+	f, err := NewWithOptions(1, WithRateLimit(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.NextID()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := f.NextIDContext(ctx); err != context.Canceled {
+		t.Errorf("NextIDContext() error = %v, want context.Canceled", err)
+	}
+}
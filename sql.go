@@ -0,0 +1,91 @@
+package flake
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Scan implements sql.Scanner
+func (id *ID) Scan(src interface{}) error {
+	v, err := ParseSQL(src)
+	if err != nil {
+		return err
+	}
+	*id = v
+	return nil
+}
+
+// Value implements driver.Valuer, storing the ID as a signed 64-bit integer.
+// It returns the error of Int64 for IDs with the top bit set.
+func (id ID) Value() (driver.Value, error) {
+	v, err := id.Int64()
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// NullID represents an ID that may be NULL. It implements sql.Scanner and
+// driver.Valuer like sql.NullInt64.
+type NullID struct {
+	ID    ID
+	Valid bool // Valid is true if ID is not NULL
+}
+
+// Scan implements sql.Scanner
+func (n *NullID) Scan(src interface{}) error {
+	if src == nil {
+		n.ID, n.Valid = 0, false
+		return nil
+	}
+	if err := n.ID.Scan(src); err != nil {
+		n.Valid = false
+		return err
+	}
+	n.Valid = true
+	return nil
+}
+
+// Value implements driver.Valuer, storing the ID as a signed 64-bit integer
+// or NULL when it is not valid
+func (n NullID) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return n.ID.Value()
+}
+
+// ParseSQL converts a value read from a database column into an ID. Integers
+// are taken as the raw ID value and strings and byte slices as its decimal
+// form. Floats are accepted when they hold an integral value.
+func ParseSQL(v interface{}) (ID, error) {
+	switch v := v.(type) {
+	case int64:
+		return ID(v), nil
+	case uint64:
+		return ID(v), nil
+	case string:
+		return parseDecimal(v)
+	case []byte:
+		return parseDecimal(string(v))
+	case float64:
+		if v < 0 || v >= math.MaxUint64 || v != math.Trunc(v) {
+			return 0, fmt.Errorf("cannot convert float %v to an ID", v)
+		}
+		return ID(v), nil
+	case nil:
+		return 0, fmt.Errorf("cannot convert NULL to an ID")
+	default:
+		return 0, fmt.Errorf("cannot convert %T to an ID", v)
+	}
+}
+
+func parseDecimal(s string) (ID, error) {
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("cannot convert %q to an ID: %v", s, err)
+	}
+	return ID(n), nil
+}
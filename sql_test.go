@@ -0,0 +1,89 @@
+package flake
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParseSQL(t *testing.T) {
+	tests := []struct {
+		src  interface{}
+		want ID
+	}{
+		{int64(123456789), 123456789},
+		{uint64(1 << 63), 1 << 63},
+		{"987654321", 987654321},
+		{[]byte("42"), 42},
+		{float64(1 << 40), 1 << 40},
+	}
+	for _, tt := range tests {
+		got, err := ParseSQL(tt.src)
+		if err != nil {
+			t.Errorf("ParseSQL(%#v) error: %v", tt.src, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseSQL(%#v) = %d, want %d", tt.src, got, tt.want)
+		}
+	}
+
+	for _, src := range []interface{}{"abc", float64(1.5), float64(-1), nil} {
+		if _, err := ParseSQL(src); err == nil {
+			t.Errorf("ParseSQL(%#v) expected an error", src)
+		}
+	}
+
+	_, err := ParseSQL(true)
+	if err == nil || !strings.Contains(err.Error(), "bool") {
+		t.Errorf("ParseSQL(true) error = %v, want one naming the bool type", err)
+	}
+}
+
+func TestScanValue(t *testing.T) {
+	want := New(1).NextID()
+	v, err := want.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got ID
+	if err := got.Scan(v); err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("Scan(Value()) = %d, want %d", got, want)
+	}
+
+	if v, err := ID(math.MaxInt64 + 1).Value(); err == nil {
+		t.Errorf("Value() = %v with the top bit set, want an error", v)
+	}
+}
+
+func TestNullID(t *testing.T) {
+	n := NullID{ID: 1, Valid: true}
+	if err := n.Scan(nil); err != nil {
+		t.Fatal(err)
+	}
+	if n.Valid || n.ID != 0 {
+		t.Errorf("Scan(nil) = %+v, want an invalid zero ID", n)
+	}
+	if v, err := n.Value(); err != nil || v != nil {
+		t.Errorf("Value() = %v, %v, want nil", v, err)
+	}
+
+	want := New(1).NextID()
+	if err := n.Scan(int64(want)); err != nil {
+		t.Fatal(err)
+	}
+	if !n.Valid || n.ID != want {
+		t.Errorf("Scan(%d) = %+v, want a valid %d", want, n, want)
+	}
+	if v, err := n.Value(); err != nil || v != int64(want) {
+		t.Errorf("Value() = %v, %v, want %d", v, err, int64(want))
+	}
+
+	if err := n.Scan(true); err == nil || n.Valid {
+		t.Errorf("Scan(true) = %+v, %v, want an error", n, err)
+	}
+}
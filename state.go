@@ -0,0 +1,74 @@
+package flake
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// State is a snapshot of a generator returned by ExportState
+type State struct {
+	WorkerID uint64
+	Layout   Layout
+	Epoch    time.Time
+	Shards   []ShardState
+}
+
+// ShardState is the state of one sequence shard of a generator
+type ShardState struct {
+	PrevTime uint64
+	Sequence uint64
+}
+
+// ExportState returns a snapshot of the generator
+func (f *Flake) ExportState() State {
+	st := State{
+		WorkerID: f.workerID.Load(),
+		Layout:   f.layout,
+		Epoch:    f.epoch,
+		Shards:   make([]ShardState, len(f.shards)),
+	}
+	for i, s := range f.shards {
+		s.mu.Lock()
+		st.Shards[i] = ShardState{PrevTime: s.prevTime, Sequence: s.sequence}
+		s.mu.Unlock()
+	}
+	return st
+}
+
+// ImportState restores a snapshot returned by ExportState. The generator must
+// have been created with the same layout, epoch and number of shards as the
+// exported one.
+func (f *Flake) ImportState(st State) error {
+	if st.Layout != f.layout {
+		return errors.New("state layout does not match the generator")
+	}
+	if !st.Epoch.Equal(f.epoch) {
+		return errors.New("state epoch does not match the generator")
+	}
+	if st.WorkerID > f.layout.maxWorker() {
+		return fmt.Errorf("state worker id %d exceeds %d", st.WorkerID, f.layout.maxWorker())
+	}
+	if len(st.Shards) != len(f.shards) {
+		return fmt.Errorf("state has %d shards, want %d", len(st.Shards), len(f.shards))
+	}
+	for i, s := range f.shards {
+		// A shard that has not issued an ID yet holds the sequence number
+		// just below its first, which wraps around for the first shard.
+		if seq := st.Shards[i].Sequence; seq != s.first-1 && (seq < s.first || seq > s.last) {
+			return fmt.Errorf("state sequence %d is outside shard %d", seq, i)
+		}
+	}
+
+	f.workerID.Store(st.WorkerID)
+	for i, s := range f.shards {
+		s.mu.Lock()
+		s.prevTime = st.Shards[i].PrevTime
+		s.sequence = st.Shards[i].Sequence
+		if s.prevTime > s.lastClock {
+			s.lastClock = s.prevTime
+		}
+		s.mu.Unlock()
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package flake
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExportImportState(t *testing.T) {
+	at := time.Now()
+	original := New(3)
+	freeze(original, at)
+
+	var before []ID
+	for i := 0; i < 100; i++ {
+		before = append(before, original.NextID())
+	}
+	st := original.ExportState()
+	original.NextID()
+
+	restored := New(0)
+	freeze(restored, at)
+	if err := restored.ImportState(st); err != nil {
+		t.Fatal(err)
+	}
+
+	last := before[len(before)-1]
+	for i := 0; i < 100; i++ {
+		id := restored.NextID()
+		if id <= last {
+			t.Fatalf("restored ID %d is not after the snapshot's last ID %d", id, last)
+		}
+		if id.WorkerID() != 3 {
+			t.Fatalf("restored worker = %d, want 3", id.WorkerID())
+		}
+	}
+}
+
+func TestImportStateInvalid(t *testing.T) {
+	st := New(1).ExportState()
+
+	bad := st
+	bad.WorkerID = MaxWorkerID + 1
+	if err := New(1).ImportState(bad); err == nil {
+		t.Error("ImportState() accepted an out of range worker id")
+	}
+
+	bad = st
+	bad.Layout.WorkerBits--
+	if err := New(1).ImportState(bad); err == nil {
+		t.Error("ImportState() accepted a different layout")
+	}
+
+	sharded, err := NewWithOptions(1, WithSequenceShards(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sharded.ImportState(st); err == nil {
+		t.Error("ImportState() accepted a different number of shards")
+	}
+}
+
+func TestExportImportFreshState(t *testing.T) {
+	f, err := NewWithOptions(1, WithSequenceShards(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewWithOptions(1, WithSequenceShards(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.ImportState(f.ExportState()); err != nil {
+		t.Fatalf("ImportState() of a fresh generator: %v", err)
+	}
+	if err := New(1).ImportState(New(1).ExportState()); err != nil {
+		t.Fatalf("ImportState() of a fresh generator: %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package flake
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// tagSize is the number of bytes of the HMAC kept in a signed token.
+const tagSize = 8
+
+// ErrInvalidToken is returned by VerifySignedToken for malformed or tampered
+// tokens.
+var ErrInvalidToken = errors.New("invalid signed token")
+
+// SignedToken returns the base62 form of the ID followed by a dot and an
+// HMAC-SHA256 tag computed with key, so that the ID cannot be altered or
+// guessed by someone who does not know the key
+func (id ID) SignedToken(key []byte) string {
+	return id.Base62() + "." + base64.RawURLEncoding.EncodeToString(signID(id, key))
+}
+
+// VerifySignedToken checks the tag of a token returned by SignedToken and
+// returns its ID
+func VerifySignedToken(token string, key []byte) (ID, error) {
+	s, encoded, ok := strings.Cut(token, ".")
+	if !ok {
+		return 0, ErrInvalidToken
+	}
+	id, err := ParseBase62(s)
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+	tag, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || !hmac.Equal(tag, signID(id, key)) {
+		return 0, ErrInvalidToken
+	}
+	return id, nil
+}
+
+func signID(id ID, key []byte) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(id))
+	mac := hmac.New(sha256.New, key)
+	mac.Write(b[:])
+	return mac.Sum(nil)[:tagSize]
+}
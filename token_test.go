@@ -0,0 +1,28 @@
+package flake
+
+import "testing"
+
+func TestSignedToken(t *testing.T) {
+	key := []byte("secret")
+	id := New(1).NextID()
+	token := id.SignedToken(key)
+
+	got, err := VerifySignedToken(token, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != id {
+		t.Errorf("VerifySignedToken() = %d, want %d", got, id)
+	}
+
+	tampered := (id + 1).Base62() + token[len(id.Base62()):]
+	for _, bad := range []string{tampered, token[:len(token)-1], id.Base62(), ""} {
+		if _, err := VerifySignedToken(bad, key); err != ErrInvalidToken {
+			t.Errorf("VerifySignedToken(%q) error = %v, want ErrInvalidToken", bad, err)
+		}
+	}
+
+	if _, err := VerifySignedToken(token, []byte("other")); err != ErrInvalidToken {
+		t.Errorf("VerifySignedToken(wrong key) error = %v, want ErrInvalidToken", err)
+	}
+}
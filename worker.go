@@ -0,0 +1,200 @@
+package flake
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var workerLabels sync.Map
+
+// RegisterWorker associates a human readable label with a worker id
+func RegisterWorker(workerID uint64, label string) {
+	workerLabels.Store(workerID, label)
+}
+
+// WorkerLabel returns the label registered for a worker id, or an empty
+// string if there is none
+func WorkerLabel(workerID uint64) string {
+	if label, ok := workerLabels.Load(workerID); ok {
+		return label.(string)
+	}
+	return ""
+}
+
+// PickWorkerID returns the lowest worker id between 0 and MaxWorkerID that is
+// not in used, or an error if every worker id is taken
+func PickWorkerID(used []uint64) (uint64, error) {
+	taken := make([]bool, MaxWorkerID+1)
+	for _, id := range used {
+		if id <= MaxWorkerID {
+			taken[id] = true
+		}
+	}
+	for id, t := range taken {
+		if !t {
+			return uint64(id), nil
+		}
+	}
+	return 0, errors.New("all worker ids are in use")
+}
+
+// WouldCollide reports whether New maps the worker ids a and b to the same
+// worker, because they only differ in bits above MaxWorkerID
+func WouldCollide(a, b uint64) bool {
+	return a&MaxWorkerID == b&MaxWorkerID
+}
+
+// CollisionProbability estimates the probability that some of nodes
+// generators with the given layout generate the same ID within one
+// millisecond, when each generates idsPerMsPerNode IDs per millisecond with a
+// random worker id. It is the birthday estimate over the worker ids and
+// sequence numbers of the layout, taking the sequence numbers of each ID to be
+// random as with WithRandomSequence. Generators counting their sequence from
+// zero collide whenever two of them share a worker id, which is more likely.
+func CollisionProbability(nodes, idsPerMsPerNode int, layout Layout) float64 {
+	if nodes < 2 || idsPerMsPerNode < 1 {
+		return 0
+	}
+	// A generator cannot generate more IDs per millisecond than it has
+	// sequence numbers.
+	perNode := min(float64(idsPerMsPerNode), float64(layout.maxSequence())+1)
+	space := (float64(layout.maxWorker()) + 1) * (float64(layout.maxSequence()) + 1)
+	// Every pair of IDs of different generators is equal with probability
+	// 1/space.
+	pairs := float64(nodes) * float64(nodes-1) / 2 * perNode * perNode
+	return -math.Expm1(-pairs / space)
+}
+
+// WithFileID creates new ID generator with the worker id read from a file,
+// such as one mounted by the Kubernetes downward API. The trimmed contents of
+// the file are converted by parse, or parsed as a decimal integer if parse is
+// nil. The worker id must not exceed MaxWorkerID.
+func WithFileID(path string, parse func(string) (uint64, error)) (*Flake, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if parse == nil {
+		parse = func(s string) (uint64, error) { return strconv.ParseUint(s, 10, 64) }
+	}
+
+	workerID, err := parse(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid worker id in %s: %v", path, err)
+	}
+	if workerID > MaxWorkerID {
+		return nil, fmt.Errorf("worker id %d in %s exceeds %d", workerID, path, MaxWorkerID)
+	}
+	return New(workerID), nil
+}
+
+// WorkerIDProvider derives the worker id of a generator
+type WorkerIDProvider func() (uint64, error)
+
+// HostIDProvider derives the worker id from the IP address of the host
+func HostIDProvider() WorkerIDProvider {
+	return getHostID
+}
+
+// RandomIDProvider draws a random worker id
+func RandomIDProvider() WorkerIDProvider {
+	return getRandomID
+}
+
+// EnvIDProvider reads the worker id as a decimal integer from the named
+// environment variable
+func EnvIDProvider(name string) WorkerIDProvider {
+	return func() (uint64, error) {
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return 0, fmt.Errorf("environment variable %s is not set", name)
+		}
+		workerID, err := strconv.ParseUint(strings.TrimSpace(v), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid worker id in %s: %v", name, err)
+		}
+		return workerID, nil
+	}
+}
+
+// WithIDStrategies creates new ID generator with the worker id of the first
+// provider that succeeds. If every provider fails, the returned error joins
+// their errors.
+func WithIDStrategies(strategies ...WorkerIDProvider) (*Flake, error) {
+	var errs []error
+	for _, provide := range strategies {
+		workerID, err := provide()
+		if err == nil {
+			return New(workerID), nil
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return nil, errors.New("no worker id strategies given")
+	}
+	return nil, errors.Join(errs...)
+}
+
+// WithWorkerIDHashString creates new ID generator with a worker id derived
+// from the FNV-1a hash of name. Nodes with the same name get the same worker
+// id, and distinct names may still collide, with a chance of 1 in 1024 for
+// any pair.
+func WithWorkerIDHashString(name string) *Flake {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return New(h.Sum64())
+}
+
+// workerRefresh tracks the rediscovery of the worker id set up by
+// WithIDRefresh.
+type workerRefresh struct {
+	interval time.Duration
+	due      atomic.Int64 // in Unix nanoseconds
+	running  atomic.Bool
+}
+
+// refreshWorker derives the worker id from the host address if the interval
+// has passed since it last did, in the background unless wait is set.
+func (f *Flake) refreshWorker(wait bool) {
+	r := f.refresh
+	now := f.now().UnixNano()
+	if now < r.due.Load() || !r.running.CompareAndSwap(false, true) {
+		return
+	}
+	r.due.Store(now + int64(r.interval))
+	refresh := func() {
+		defer r.running.Store(false)
+		if workerID, err := getHostID(); err == nil {
+			f.switchWorker(f.layout.foldWorker(workerID))
+		}
+	}
+	if wait {
+		refresh()
+	} else {
+		go refresh()
+	}
+}
+
+// switchWorker sets the worker id and moves every shard on to a new timestamp
+// if it changed.
+func (f *Flake) switchWorker(workerID uint64) {
+	for _, s := range f.shards {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+	}
+	if f.workerID.Load() == workerID {
+		return
+	}
+	f.workerID.Store(workerID)
+	for _, s := range f.shards {
+		s.sequence = s.last
+	}
+}
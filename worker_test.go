@@ -0,0 +1,325 @@
+package flake
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubHost replaces the hostname and resolver used by getHostID until the
+// test ends.
+func stubHost(t *testing.T, name func() (string, error), lookup func(string) ([]net.IP, error)) {
+	t.Cleanup(func() {
+		hostname = os.Hostname
+		lookupIP = net.LookupIP
+		interfaceAddrs = net.InterfaceAddrs
+	})
+	hostname = name
+	lookupIP = lookup
+}
+
+func TestWorkerLabel(t *testing.T) {
+	RegisterWorker(42, "us-east-api-3")
+	defer workerLabels.Delete(uint64(42))
+
+	id := New(42).NextID()
+	if got := WorkerLabel(id.WorkerID()); got != "us-east-api-3" {
+		t.Errorf("WorkerLabel() = %q, want %q", got, "us-east-api-3")
+	}
+	if got := WorkerLabel(43); got != "" {
+		t.Errorf("WorkerLabel(43) = %q, want empty", got)
+	}
+}
+
+func TestPickWorkerID(t *testing.T) {
+	if got, err := PickWorkerID(nil); err != nil || got != 0 {
+		t.Errorf("PickWorkerID(nil) = %d, %v, want 0", got, err)
+	}
+
+	if got, err := PickWorkerID([]uint64{0, 1, 2, 4, 5}); err != nil || got != 3 {
+		t.Errorf("PickWorkerID(gapped) = %d, %v, want 3", got, err)
+	}
+
+	all := make([]uint64, MaxWorkerID+1)
+	for i := range all {
+		all[i] = uint64(i)
+	}
+	if _, err := PickWorkerID(all); err == nil {
+		t.Error("PickWorkerID(all) expected an error")
+	}
+
+	// The last worker id must be usable as is.
+	if got, err := PickWorkerID(all[:MaxWorkerID]); err != nil || got != MaxWorkerID {
+		t.Errorf("PickWorkerID(all but last) = %d, %v, want %d", got, err, MaxWorkerID)
+	}
+	if got := New(MaxWorkerID).NextID().WorkerID(); got != MaxWorkerID {
+		t.Errorf("New(MaxWorkerID) worker = %d, want %d", got, MaxWorkerID)
+	}
+}
+
+func TestWouldCollide(t *testing.T) {
+	tests := []struct {
+		a, b uint64
+		want bool
+	}{
+		{0, 1024, true},
+		{5, 1029, true},
+		{1023, 2047, true},
+		{7, 7, true},
+		{10<<24 | 1<<8 | 7, 1<<8 | 7, true},
+		{0, 1023, false},
+		{1, 2, false},
+		{1024, 1025, false},
+	}
+	for _, tt := range tests {
+		if got := WouldCollide(tt.a, tt.b); got != tt.want {
+			t.Errorf("WouldCollide(%d, %d) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+		if collide := New(tt.a).NextID().WorkerID() == New(tt.b).NextID().WorkerID(); collide != tt.want {
+			t.Errorf("New(%d) and New(%d) collide = %v, want %v", tt.a, tt.b, collide, tt.want)
+		}
+	}
+}
+
+func TestCollisionProbability(t *testing.T) {
+	if p := CollisionProbability(10, 1, DefaultLayout); p <= 0 || p > 1e-5 {
+		t.Errorf("10 nodes at 1 ID/ms with the default layout: probability %v, want tiny", p)
+	}
+
+	// Too few worker bits for the number of nodes.
+	narrow := Layout{TimestampBits: 41, WorkerBits: 4, SequenceBits: 19}
+	if p := CollisionProbability(100, 1000, narrow); p < 0.99 || p > 1 {
+		t.Errorf("100 nodes with 4 worker bits: probability %v, want high", p)
+	}
+
+	// Both the load and the sequence bits count.
+	low, high := CollisionProbability(10, 10, DefaultLayout), CollisionProbability(10, 100, DefaultLayout)
+	if low >= high {
+		t.Errorf("probability %v at 10 IDs/ms is not below %v at 100 IDs/ms", low, high)
+	}
+	fewer := Layout{TimestampBits: 41, WorkerBits: 10, SequenceBits: 8}
+	if p := CollisionProbability(10, 10, fewer); p <= low {
+		t.Errorf("probability %v with 8 sequence bits is not above %v with 13", p, low)
+	}
+
+	if p := CollisionProbability(1, 100, narrow); p != 0 {
+		t.Errorf("single node: probability %v, want 0", p)
+	}
+	if p := CollisionProbability(10, 0, narrow); p != 0 {
+		t.Errorf("no load: probability %v, want 0", p)
+	}
+}
+
+func TestMustWithHostID(t *testing.T) {
+	stubHost(t,
+		func() (string, error) { return "api-7", nil },
+		func(string) ([]net.IP, error) { return []net.IP{net.IPv4(10, 0, 1, 7)}, nil })
+
+	f := MustWithHostID()
+	if got, want := f.NextID().WorkerID(), uint64(1<<8|7); got != want {
+		t.Errorf("worker = %d, want %d", got, want)
+	}
+
+	hostname = func() (string, error) { return "", errors.New("no hostname") }
+	interfaceAddrs = func() ([]net.Addr, error) { return nil, errors.New("no interfaces") }
+	defer func() {
+		if recover() == nil {
+			t.Error("MustWithHostID did not panic")
+		}
+	}()
+	MustWithHostID()
+}
+
+func TestWithFileID(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, contents string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	f, err := WithFileID(write("ordinal", "7\n"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.NextID().WorkerID(); got != 7 {
+		t.Errorf("worker = %d, want 7", got)
+	}
+
+	ordinal := func(s string) (uint64, error) {
+		return strconv.ParseUint(s[strings.LastIndexByte(s, '-')+1:], 10, 64)
+	}
+	f, err = WithFileID(write("podname", "api-12"), ordinal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.NextID().WorkerID(); got != 12 {
+		t.Errorf("worker = %d, want 12", got)
+	}
+
+	for _, path := range []string{
+		filepath.Join(dir, "missing"),
+		write("garbage", "api"),
+		write("large", "1024"),
+	} {
+		if _, err := WithFileID(path, nil); err == nil {
+			t.Errorf("WithFileID(%s) expected an error", filepath.Base(path))
+		}
+	}
+}
+
+func TestWithIDStrategies(t *testing.T) {
+	t.Setenv("FLAKE_TEST_WORKER_ID", "9")
+	failing := func() (uint64, error) { return 0, errors.New("unavailable") }
+
+	f, err := WithIDStrategies(failing, EnvIDProvider("FLAKE_TEST_WORKER_ID"), RandomIDProvider())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.NextID().WorkerID(); got != 9 {
+		t.Errorf("worker = %d, want 9", got)
+	}
+
+	_, err = WithIDStrategies(failing, EnvIDProvider("FLAKE_TEST_UNSET"))
+	if err == nil || !strings.Contains(err.Error(), "unavailable") || !strings.Contains(err.Error(), "FLAKE_TEST_UNSET") {
+		t.Errorf("error = %v, want both provider errors", err)
+	}
+
+	if _, err := WithIDStrategies(); err == nil {
+		t.Error("WithIDStrategies() expected an error")
+	}
+}
+
+func TestWithWorkerIDHashString(t *testing.T) {
+	a := WithWorkerIDHashString("us-east-api-3").NextID().WorkerID()
+	b := WithWorkerIDHashString("us-east-api-3").NextID().WorkerID()
+	if a != b {
+		t.Errorf("same name gave worker ids %d and %d", a, b)
+	}
+
+	distinct := make(map[uint64]bool)
+	for i := 0; i < 100; i++ {
+		workerID := WithWorkerIDHashString("node-" + strconv.Itoa(i)).NextID().WorkerID()
+		if workerID > MaxWorkerID {
+			t.Fatalf("worker id %d exceeds %d", workerID, MaxWorkerID)
+		}
+		distinct[workerID] = true
+	}
+	if len(distinct) < 90 {
+		t.Errorf("100 names gave only %d distinct worker ids", len(distinct))
+	}
+}
+
+func TestHostIDInterfaceFallback(t *testing.T) {
+	stubHost(t,
+		func() (string, error) { return "", errors.New("no hostname") },
+		net.LookupIP)
+	interfaceAddrs = func() ([]net.Addr, error) {
+		return []net.Addr{
+			&net.IPNet{IP: net.IPv4(127, 0, 0, 1), Mask: net.CIDRMask(8, 32)},
+			&net.IPNet{IP: net.ParseIP("fe80::1"), Mask: net.CIDRMask(64, 128)},
+			&net.IPNet{IP: net.IPv4(192, 168, 2, 9), Mask: net.CIDRMask(24, 32)},
+		}, nil
+	}
+
+	f, err := WithHostID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := f.NextID().WorkerID(), uint64(2<<8|9); got != want {
+		t.Errorf("worker = %d, want %d", got, want)
+	}
+
+	interfaceAddrs = func() ([]net.Addr, error) { return nil, nil }
+	if _, err := WithHostID(); err == nil || !strings.Contains(err.Error(), "no hostname") {
+		t.Errorf("WithHostID() error = %v, want the hostname and interface errors", err)
+	}
+}
+
+func TestWithIDRefresh(t *testing.T) {
+	ip := net.IPv4(10, 0, 1, 7)
+	var mu sync.Mutex
+	stubHost(t,
+		func() (string, error) { return "laptop", nil },
+		func(string) ([]net.IP, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return []net.IP{ip}, nil
+		})
+	setIP := func(a, b, c, d byte) {
+		mu.Lock()
+		ip = net.IPv4(a, b, c, d)
+		mu.Unlock()
+	}
+
+	workerID, err := getHostID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewWithOptions(workerID, WithIDRefresh(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Now()
+	freeze(f, at)
+
+	// waitFor generates IDs until one has the given worker id.
+	waitFor := func(want uint64) ID {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+			if id := f.NextID(); id.WorkerID() == want {
+				return id
+			}
+			time.Sleep(time.Millisecond)
+		}
+		t.Fatalf("worker id did not change to %d", want)
+		return 0
+	}
+
+	last := f.NextID()
+	setIP(10, 0, 2, 9)
+	freeze(f, at.Add(2*time.Minute))
+	first := waitFor(2<<8 | 9)
+	if first <= last || f.layout.timestamp(first) <= f.layout.timestamp(last) {
+		t.Errorf("first ID %d with the new worker id is not at a later timestamp than %d", first, last)
+	}
+
+	// The address is not looked up again until the interval has passed.
+	setIP(10, 0, 3, 1)
+	for f.refresh.running.Load() {
+		time.Sleep(time.Millisecond)
+	}
+	if got := f.NextID().WorkerID(); got != 2<<8|9 {
+		t.Errorf("worker = %d before the interval passed, want %d", got, 2<<8|9)
+	}
+	freeze(f, at.Add(4*time.Minute))
+	waitFor(3<<8 | 1)
+}
+
+func TestWithIDRefreshKeepsWorkerID(t *testing.T) {
+	stubHost(t,
+		func() (string, error) { return "laptop", nil },
+		func(string) ([]net.IP, error) { return []net.IP{net.IPv4(10, 0, 2, 9)}, nil })
+	f, err := NewWithOptions(7, WithIDRefresh(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The address is first looked up an interval after construction.
+	for i := 0; i < 100; i++ {
+		if got := f.NextID().WorkerID(); got != 7 {
+			t.Fatalf("worker of ID %d = %d, want the explicit worker id 7", i, got)
+		}
+	}
+	if f.refresh.running.Load() {
+		t.Error("the first IDs started a host lookup")
+	}
+}